@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// abiEntry is a function, event, error or constructor of a contract ABI.
+type abiEntry struct {
+	Type    string     `json:"type"`
+	Name    string     `json:"name"`
+	Inputs  []abiParam `json:"inputs"`
+	Outputs []abiParam `json:"outputs"`
+}
+
+type abiParam struct {
+	Type       string     `json:"type"`
+	Components []abiParam `json:"components"`
+}
+
+// abiSignatures returns the signatures of the functions and events of a
+// JSON encoded ABI, in the order of the ABI, such as
+// "function transfer(address,uint256)" or "event Transfer(address,address,uint256)".
+func abiSignatures(rawABI string) ([]string, error) {
+	entries := []abiEntry{}
+	if err := json.Unmarshal([]byte(rawABI), &entries); err != nil {
+		return nil, fmt.Errorf("could not decode ABI: %v", err)
+	}
+
+	signatures := []string{}
+	for _, entry := range entries {
+		if entry.Type != "function" && entry.Type != "event" {
+			continue
+		}
+
+		signature := fmt.Sprintf("%s %s(%s)", entry.Type, entry.Name, abiTypes(entry.Inputs))
+		if entry.Type == "function" && len(entry.Outputs) > 0 {
+			signature += fmt.Sprintf(" returns (%s)", abiTypes(entry.Outputs))
+		}
+		signatures = append(signatures, signature)
+	}
+
+	return signatures, nil
+}
+
+// abiTypes returns the comma separated canonical types of the parameters.
+// Tuples are written as the list of their component types.
+func abiTypes(params []abiParam) string {
+	types := make([]string, 0, len(params))
+	for _, p := range params {
+		t := p.Type
+		if suffix, isTuple := strings.CutPrefix(t, "tuple"); isTuple {
+			t = "(" + abiTypes(p.Components) + ")" + suffix
+		}
+		types = append(types, t)
+	}
+
+	return strings.Join(types, ",")
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// apiResponse is the envelope of the responses of the explorer API. When
+// status is not "1", result holds the error message.
+type apiResponse struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Result  json.RawMessage `json:"result"`
+}
+
+// contractCreation is the deployment information of a contract.
+type contractCreation struct {
+	ContractCreator string `json:"contractCreator"`
+	TxHash          string `json:"txHash"`
+}
+
+// getAPI calls an action of the explorer API of the chain and decodes its
+// result into v.
+func getAPI(f *fetcher, c chain, apiKey string, params url.Values, v any) error {
+	if c.APIURL == "" {
+		return fmt.Errorf("chain %s does not have an explorer API", c.Name)
+	}
+
+	if apiKey != "" {
+		params.Set("apikey", apiKey)
+	}
+
+	raw, err := f.get(c.apiRequestURL(params))
+	if err != nil {
+		return err
+	}
+
+	resp := apiResponse{}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return fmt.Errorf("could not decode the API response: %v", err)
+	}
+
+	if resp.Status != "1" {
+		message := resp.Message
+		var detail string
+		if json.Unmarshal(resp.Result, &detail) == nil && detail != "" {
+			message = message + ": " + detail
+		}
+		return fmt.Errorf("API call %s failed: %s", params.Get("action"), message)
+	}
+
+	if err := json.Unmarshal(resp.Result, v); err != nil {
+		return fmt.Errorf("could not decode the result of API call %s: %v", params.Get("action"), err)
+	}
+
+	return nil
+}
+
+// getContractCreation returns the creation transaction and the deployer of
+// the contract.
+func getContractCreation(f *fetcher, c chain, apiKey, contractAddress string) (*contractCreation, error) {
+	params := url.Values{}
+	params.Set("module", "contract")
+	params.Set("action", "getcontractcreation")
+	params.Set("contractaddresses", contractAddress)
+
+	creations := []contractCreation{}
+	if err := getAPI(f, c, apiKey, params, &creations); err != nil {
+		return nil, err
+	}
+
+	if len(creations) == 0 {
+		return nil, fmt.Errorf("the explorer does not know the creation of %s", contractAddress)
+	}
+
+	return &creations[0], nil
+}
+
+// getContractABI returns the JSON encoded ABI of a verified contract.
+func getContractABI(f *fetcher, c chain, apiKey, contractAddress string) (string, error) {
+	params := url.Values{}
+	params.Set("module", "contract")
+	params.Set("action", "getabi")
+	params.Set("address", contractAddress)
+
+	var abi string
+	if err := getAPI(f, c, apiKey, params, &abi); err != nil {
+		return "", err
+	}
+
+	return abi, nil
+}
+
+// rpcResponse is the envelope of the responses of the proxy module of the
+// explorer API, which forwards JSON-RPC calls to a node. Failures of the
+// API itself still use the apiResponse envelope.
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// getRPC forwards a JSON-RPC call to a node through the proxy module of
+// the explorer API and decodes its result into v. A null result is
+// reported with found set to false.
+func getRPC(f *fetcher, c chain, apiKey string, params url.Values, v any) (found bool, err error) {
+	if c.APIURL == "" {
+		return false, fmt.Errorf("chain %s does not have an explorer API", c.Name)
+	}
+
+	params.Set("module", "proxy")
+	if apiKey != "" {
+		params.Set("apikey", apiKey)
+	}
+
+	raw, err := f.get(c.apiRequestURL(params))
+	if err != nil {
+		return false, err
+	}
+
+	resp := rpcResponse{}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return false, fmt.Errorf("could not decode the API response: %v", err)
+	}
+
+	if resp.Error != nil {
+		return false, fmt.Errorf("API call %s failed: %s", params.Get("action"), resp.Error.Message)
+	}
+	if resp.Status == "0" {
+		message := resp.Message
+		var detail string
+		if json.Unmarshal(resp.Result, &detail) == nil && detail != "" {
+			message = message + ": " + detail
+		}
+		return false, fmt.Errorf("API call %s failed: %s", params.Get("action"), message)
+	}
+
+	if len(resp.Result) == 0 || string(resp.Result) == "null" {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(resp.Result, v); err != nil {
+		return false, fmt.Errorf("could not decode the result of API call %s: %v", params.Get("action"), err)
+	}
+
+	return true, nil
+}
+
+// getCreatedContract returns the address of the contract created by the
+// transaction, from its receipt.
+func getCreatedContract(f *fetcher, c chain, apiKey, txHash string) (string, error) {
+	params := url.Values{}
+	params.Set("action", "eth_getTransactionReceipt")
+	params.Set("txhash", txHash)
+
+	receipt := struct {
+		ContractAddress *string `json:"contractAddress"`
+	}{}
+	found, err := getRPC(f, c, apiKey, params, &receipt)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("transaction %s was not found, it may be pending or on another chain", txHash)
+	}
+
+	if receipt.ContractAddress == nil || *receipt.ContractAddress == "" {
+		return "", fmt.Errorf("transaction %s did not create a contract", txHash)
+	}
+
+	return *receipt.ContractAddress, nil
+}
+
+// callContract runs a read only call of the contract with the ABI encoded
+// data, and returns the ABI encoded result.
+func callContract(f *fetcher, c chain, apiKey, contractAddress string, data []byte) ([]byte, error) {
+	params := url.Values{}
+	params.Set("action", "eth_call")
+	params.Set("to", contractAddress)
+	params.Set("data", "0x"+hex.EncodeToString(data))
+	params.Set("tag", "latest")
+
+	var result string
+	found, err := getRPC(f, c, apiKey, params, &result)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("the call to %s did not return a result", contractAddress)
+	}
+
+	raw, err := hex.DecodeString(strings.TrimPrefix(result, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the result of the call to %s: %v", contractAddress, err)
+	}
+
+	return raw, nil
+}
+
+// deployedContractsPageSize is the number of transactions asked for in
+// each page of the transaction list, the maximum allowed by the explorer.
+const deployedContractsPageSize = 1000
+
+// getDeployedContracts returns the addresses of the contracts created by
+// the transactions of the deployer, oldest first. Contracts created by
+// other contracts are not listed.
+func getDeployedContracts(f *fetcher, c chain, apiKey, deployer string) ([]string, error) {
+	contracts := []string{}
+	for page := 1; ; page++ {
+		params := url.Values{}
+		params.Set("module", "account")
+		params.Set("action", "txlist")
+		params.Set("address", deployer)
+		params.Set("startblock", "0")
+		params.Set("endblock", "99999999")
+		params.Set("page", strconv.Itoa(page))
+		params.Set("offset", strconv.Itoa(deployedContractsPageSize))
+		params.Set("sort", "asc")
+
+		txs := []struct {
+			From            string `json:"from"`
+			To              string `json:"to"`
+			ContractAddress string `json:"contractAddress"`
+			IsError         string `json:"isError"`
+		}{}
+		if err := getAPI(f, c, apiKey, params, &txs); err != nil {
+			// the explorer reports an empty list as a failure
+			if strings.Contains(err.Error(), "No transactions found") {
+				break
+			}
+			if page > 1 && strings.Contains(err.Error(), "Result window is too large") {
+				warnf("the explorer lists only the first %d transactions of %s, later deployments are missing", (page-1)*deployedContractsPageSize, deployer)
+				break
+			}
+			return nil, err
+		}
+
+		for _, tx := range txs {
+			if tx.To == "" && tx.ContractAddress != "" && tx.IsError != "1" && strings.EqualFold(tx.From, deployer) {
+				contracts = append(contracts, tx.ContractAddress)
+			}
+		}
+
+		if len(txs) < deployedContractsPageSize {
+			break
+		}
+	}
+
+	return contracts, nil
+}
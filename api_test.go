@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// apiServer serves the saved API response testdata/api/<name>.json for
+// every request.
+func apiServer(t *testing.T, name string) chain {
+	t.Helper()
+
+	body, err := os.ReadFile(filepath.Join("testdata", "api", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+
+	return chain{Name: "test", ID: 1, APIURL: srv.URL + "/api"}
+}
+
+func TestGetContractCreation(t *testing.T) {
+	c := apiServer(t, "getcontractcreation")
+
+	creation, err := getContractCreation(newFetcher(fetcherOptions{}), c, "key", "0x9fe46736679d2d9a65f0992f2272de9f3c7fa6e0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creation.ContractCreator != "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266" {
+		t.Errorf("creator = %s", creation.ContractCreator)
+	}
+	if !strings.HasPrefix(creation.TxHash, "0x4d2b5a0e") {
+		t.Errorf("tx hash = %s", creation.TxHash)
+	}
+}
+
+func TestGetContractCreationNotOK(t *testing.T) {
+	c := apiServer(t, "getcontractcreation-notok")
+
+	_, err := getContractCreation(newFetcher(fetcherOptions{}), c, "key", "0x9fe46736679d2d9a65f0992f2272de9f3c7fa6e0")
+	if err == nil || !strings.Contains(err.Error(), "Invalid API Key") {
+		t.Errorf("err = %v, want the message of the API", err)
+	}
+}
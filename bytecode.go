@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// runVerify compares the deployed bytecode of a contract with the runtime
+// bytecode compiled from its sources, given as hex in a file.
+func runVerify(name string, args []string) int {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	sf := addSourceFlags(fs)
+	bytecodeFile := fs.String("bytecode", "", "file with the compiled runtime bytecode, as hex (required)")
+	stripMetadata := fs.Bool("strip-metadata", false, "leave the metadata section appended by solc out of the comparison, since it changes with the comments and paths of the sources")
+	parseFlags(fs, name, args)
+
+	if fs.NArg() != 1 || *bytecodeFile == "" {
+		fs.Usage()
+		return exitError
+	}
+	contractAddress, err := normalizeAddress(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+
+	compiled, err := os.ReadFile(*bytecodeFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: could not read file %s: %v\n", *bytecodeFile, err)
+		return exitError
+	}
+
+	cfg, f, err := sf.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+
+	deployed, err := getDeployedBytecode(f, cfg, contractAddress)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s: %v\n", contractAddress, err)
+		return exitError
+	}
+
+	if !sameBytecode(deployed, string(compiled), *stripMetadata) {
+		fmt.Fprintf(os.Stderr, "error: %s: the deployed bytecode does not match %s\n", contractAddress, *bytecodeFile)
+		return exitError
+	}
+
+	fmt.Printf("%s: the deployed bytecode matches %s\n", contractAddress, *bytecodeFile)
+	return 0
+}
+
+// getDeployedBytecode returns the runtime bytecode of a contract, as hex
+// with a 0x prefix.
+func getDeployedBytecode(f *fetcher, cfg *config, contractAddress string) (string, error) {
+	params := url.Values{}
+	params.Set("action", "eth_getCode")
+	params.Set("address", contractAddress)
+	params.Set("tag", "latest")
+
+	var code string
+	if _, err := getRPC(f, cfg.Chain, cfg.APIKey, params, &code); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// sameBytecode reports whether two bytecodes, as hex, are the same. Case,
+// surrounding spaces and the 0x prefix are ignored, and with stripMetadata
+// so are the metadata sections.
+func sameBytecode(a, b string, stripMetadata bool) bool {
+	normalize := func(bytecode string) string {
+		bytecode = strings.TrimSpace(bytecode)
+		if stripMetadata {
+			bytecode = stripMetadataHash(bytecode)
+		}
+		bytecode = strings.TrimPrefix(strings.TrimPrefix(bytecode, "0x"), "0X")
+		return strings.ToLower(bytecode)
+	}
+
+	return normalize(a) == normalize(b)
+}
+
+// stripMetadataHash removes the CBOR encoded metadata section that solc
+// appends to the end of the bytecode. The last two bytes of the bytecode
+// hold the length of the metadata section. If the bytecode does not seem to
+// contain a metadata section, it is returned unchanged.
+func stripMetadataHash(bytecode string) string {
+	prefix := ""
+	code := bytecode
+	if strings.HasPrefix(code, "0x") || strings.HasPrefix(code, "0X") {
+		prefix = code[:2]
+		code = code[2:]
+	}
+
+	raw, err := hex.DecodeString(code)
+	if err != nil || len(raw) < 2 {
+		return bytecode
+	}
+
+	metadataLen := int(raw[len(raw)-2])<<8 | int(raw[len(raw)-1])
+	if metadataLen == 0 || metadataLen+2 > len(raw) {
+		return bytecode
+	}
+
+	// the CBOR metadata section always starts with a map
+	metadataStart := len(raw) - 2 - metadataLen
+	if raw[metadataStart]&0xe0 != 0xa0 {
+		return bytecode
+	}
+
+	return prefix + code[:metadataStart*2]
+}
@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+// testMetadata is the metadata section solc 0.8.20 appends to the runtime
+// bytecode: the IPFS hash of the metadata file, the compiler version and
+// the length of the section.
+const testMetadata = "a2646970667358221220111111111111111111111111111111111111111111111111111111111111111164736f6c63430008140033"
+
+func TestStripMetadataHash(t *testing.T) {
+	tests := []struct {
+		bytecode string
+		want     string
+	}{
+		{"0x6080604052" + testMetadata, "0x6080604052"},
+		{"6080604052" + testMetadata, "6080604052"},
+		// without a metadata section the bytecode is kept
+		{"0x6080604052", "0x6080604052"},
+		{"0x60806040520010", "0x60806040520010"},
+		{"0x", "0x"},
+		{"not hex", "not hex"},
+	}
+
+	for _, tt := range tests {
+		if got := stripMetadataHash(tt.bytecode); got != tt.want {
+			t.Errorf("stripMetadataHash(%q) = %q, want %q", tt.bytecode, got, tt.want)
+		}
+	}
+}
+
+func TestSameBytecode(t *testing.T) {
+	otherMetadata := testMetadata[:20] + "22" + testMetadata[22:]
+
+	tests := []struct {
+		a, b          string
+		stripMetadata bool
+		want          bool
+	}{
+		{"0x6080604052" + testMetadata, "6080604052" + testMetadata + "\n", false, true},
+		{"0x6080604052", "0X6080604052", false, true},
+		{"0x6080604052" + testMetadata, "0x6080604052" + otherMetadata, false, false},
+		{"0x6080604052" + testMetadata, "0x6080604052" + otherMetadata, true, true},
+		{"0x6080604052" + testMetadata, "0x6080604053" + testMetadata, true, false},
+	}
+
+	for _, tt := range tests {
+		if got := sameBytecode(tt.a, tt.b, tt.stripMetadata); got != tt.want {
+			t.Errorf("sameBytecode(%q, %q, %t) = %t, want %t", tt.a, tt.b, tt.stripMetadata, got, tt.want)
+		}
+	}
+}
+
+func TestGetDeployedBytecode(t *testing.T) {
+	cfg := &config{Chain: apiServer(t, "eth_getcode"), APIKey: "key"}
+
+	code, err := getDeployedBytecode(newFetcher(fetcherOptions{}), cfg, "0x9fe46736679d2d9a65f0992f2272de9f3c7fa6e0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameBytecode(code, "0x6080604052348015600f57600080fd5b", true) {
+		t.Errorf("code = %s", code)
+	}
+}
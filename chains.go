@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// chain is a network with an Etherscan compatible explorer.
+type chain struct {
+	Name        string
+	ID          int
+	ExplorerURL string
+	APIURL      string
+}
+
+const defaultChain string = "mainnet"
+
+const (
+	// apiVersionV1 uses the API of the explorer of each chain
+	apiVersionV1 string = "v1"
+
+	// apiVersionV2 uses the unified Etherscan API, which serves every
+	// chain from one endpoint and with one API key
+	apiVersionV2 string = "v2"
+
+	etherscanV2APIURL string = "https://api.etherscan.io/v2/api"
+)
+
+var chains = []chain{
+	{Name: "mainnet", ID: 1, ExplorerURL: "https://etherscan.io", APIURL: "https://api.etherscan.io/api"},
+	{Name: "sepolia", ID: 11155111, ExplorerURL: "https://sepolia.etherscan.io", APIURL: "https://api-sepolia.etherscan.io/api"},
+	{Name: "holesky", ID: 17000, ExplorerURL: "https://holesky.etherscan.io", APIURL: "https://api-holesky.etherscan.io/api"},
+	{Name: "optimism", ID: 10, ExplorerURL: "https://optimistic.etherscan.io", APIURL: "https://api-optimistic.etherscan.io/api"},
+	{Name: "bsc", ID: 56, ExplorerURL: "https://bscscan.com", APIURL: "https://api.bscscan.com/api"},
+	{Name: "gnosis", ID: 100, ExplorerURL: "https://gnosisscan.io", APIURL: "https://api.gnosisscan.io/api"},
+	{Name: "polygon", ID: 137, ExplorerURL: "https://polygonscan.com", APIURL: "https://api.polygonscan.com/api"},
+	{Name: "fantom", ID: 250, ExplorerURL: "https://ftmscan.com", APIURL: "https://api.ftmscan.com/api"},
+	{Name: "base", ID: 8453, ExplorerURL: "https://basescan.org", APIURL: "https://api.basescan.org/api"},
+	{Name: "arbitrum", ID: 42161, ExplorerURL: "https://arbiscan.io", APIURL: "https://api.arbiscan.io/api"},
+	{Name: "linea", ID: 59144, ExplorerURL: "https://lineascan.build", APIURL: "https://api.lineascan.build/api"},
+	{Name: "blast", ID: 81457, ExplorerURL: "https://blastscan.io", APIURL: "https://api.blastscan.io/api"},
+	{Name: "scroll", ID: 534352, ExplorerURL: "https://scrollscan.com", APIURL: "https://api.scrollscan.com/api"},
+}
+
+// withAPIVersion returns the chain set up to use the given version of the
+// explorer API.
+func (c chain) withAPIVersion(version string) (chain, error) {
+	switch version {
+	case apiVersionV1:
+		return c, nil
+	case apiVersionV2:
+		c.APIURL = fmt.Sprintf("%s?chainid=%d", etherscanV2APIURL, c.ID)
+		return c, nil
+	default:
+		return c, fmt.Errorf("unknown API version '%s'", version)
+	}
+}
+
+// apiRequestURL returns the URL of a request to the explorer API.
+func (c chain) apiRequestURL(params url.Values) string {
+	separator := "?"
+	if strings.Contains(c.APIURL, "?") {
+		separator = "&"
+	}
+	return c.APIURL + separator + params.Encode()
+}
+
+// lookupChain returns the chain selected by name and/or ID. An empty name
+// and a zero ID select the default chain. If both are given, they must
+// refer to the same chain.
+func lookupChain(name string, id int) (chain, error) {
+	var byName, byID *chain
+	for i := range chains {
+		if name != "" && strings.EqualFold(chains[i].Name, name) {
+			byName = &chains[i]
+		}
+		if id != 0 && chains[i].ID == id {
+			byID = &chains[i]
+		}
+	}
+
+	if name != "" && byName == nil {
+		return chain{}, fmt.Errorf("unknown chain '%s'", name)
+	}
+	if id != 0 && byID == nil {
+		return chain{}, fmt.Errorf("unknown chain ID %d", id)
+	}
+
+	switch {
+	case byName != nil && byID != nil:
+		if byName.ID != byID.ID {
+			return chain{}, fmt.Errorf("chain '%s' does not have ID %d (it is %d)", byName.Name, id, byName.ID)
+		}
+		return *byName, nil
+	case byName != nil:
+		return *byName, nil
+	case byID != nil:
+		return *byID, nil
+	}
+
+	return lookupChain(defaultChain, 0)
+}
+
+func (c chain) addressURL(contractAddress string) string {
+	return c.ExplorerURL + "/address/" + contractAddress
+}
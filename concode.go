@@ -2,88 +2,300 @@ package main
 
 import (
 	"bytes"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"path"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"golang.org/x/net/html"
 )
 
-const baseUrl string = "https://etherscan.io/address/"
 const rootDirName string = "<ROOT>"
 
+// placeholderDirName is used for the directories whose name could not be
+// inferred from the imports.
+const placeholderDirName string = "dummy"
+
 type FileName = string
 
 type SourceCodeFile struct {
-	Name         FileName
-	RawContent   string
+	Name       FileName
+	RawContent string
+
+	// Dependencies and Imports are parallel: Imports[i] is the path, as
+	// written in the import statement, of the file named Dependencies[i]
 	Dependencies []FileName
 	PathFields   []string
 	Imports      []string
+	Pragma       string
+	License      string
+
+	// OtherPragmas are the experimental and abicoder pragmas of the file,
+	// e.g. "experimental ABIEncoderV2" or "abicoder v2"
+	OtherPragmas []string
+
+	// RemoteImports are the imports of URLs, which are not part of the
+	// bundle and are not used to infer paths.
+	RemoteImports []string
+
+	// Index is the position of the file in the explorer page, starting at
+	// 1, or 0 if unknown
+	Index int
+
+	// Confidence tells how the path of the file was obtained, one of the
+	// confidence constants, or empty before the path is known
+	Confidence string
+}
+
+const (
+	// confidenceAuthoritative paths come from the source, e.g. a
+	// repository, or from a learned paths file, and are not inferred
+	confidenceAuthoritative string = "authoritative"
+
+	// confidenceInferred paths were inferred from the imports
+	confidenceInferred string = "inferred"
+
+	// confidenceGuessed paths are incomplete or have placeholder
+	// directories, and are worth double-checking
+	confidenceGuessed string = "guessed"
+)
+
+// FetchResult holds the files of a contract together with the contract
+// level information found in the explorer page.
+type FetchResult struct {
+	Files        map[FileName]*SourceCodeFile
+	ContractName string
+
+	// CompilerVersion is the exact solc version used to verify the
+	// contract, e.g. v0.8.19+commit.7dd6d404
+	CompilerVersion string
+
+	// EVMVersion is the target EVM version, "default" when the compiler
+	// default was used
+	EVMVersion       string
+	OptimizationUsed bool
+	Runs             int
+
+	// ViaIR is set when the contract was compiled through the IR pipeline,
+	// which produces a different bytecode
+	ViaIR bool
+
+	// SimilarMatch is the address of a verified contract that the explorer
+	// reports as having similar bytecode, if any
+	SimilarMatch string
+
+	// Implementation is the address of the implementation contract that
+	// the explorer reports for a proxy, if any
+	Implementation string
+
+	// Settings is the settings object of the standard JSON input used to
+	// verify the contract, if the explorer shows it
+	Settings json.RawMessage
+
+	// Libraries are the addresses of the external libraries linked into
+	// the contract, indexed by library name
+	Libraries map[string]string
+
+	// MetadataCID is the IPFS CID of the metadata the files were read
+	// from, when they were fetched with -ipfs
+	MetadataCID string
 }
 
-func getFiles(contractAddress string) (map[FileName]*SourceCodeFile, error) {
-	url := baseUrl + contractAddress
-	resp, err := http.Get(url)
+// getFiles fetches the explorer page at url and parses the source
+// code files in it. The explorer redirects to a captcha or login page when
+// it blocks a client, so a redirect to another page is an error instead of
+// a page without source code. If the page can not be parsed until the end,
+// the files read so far are returned with a *partialParseError.
+func getFiles(f *fetcher, url string, selector *sourceSelector) (*FetchResult, error) {
+	body, finalURL, err := f.getPage(url)
 	if err != nil {
-		return nil, fmt.Errorf("get request failed: %v", err)
+		return nil, err
+	}
+
+	if redirectedElsewhere(url, finalURL) {
+		return nil, fmt.Errorf(
+			"the explorer redirected %s to %s, probably a captcha or login page; wait before retrying, lower -rps or use -cache-dir to send fewer requests",
+			url, finalURL)
+	}
+
+	defer f.timings.track(stageParse, time.Now())
+	return parseFiles(bytes.NewReader(body), selector)
+}
+
+// redirectedElsewhere reports whether finalURL is a different page than
+// url. Changes of scheme, case, fragments and trailing slashes are not
+// counted.
+func redirectedElsewhere(url, finalURL string) bool {
+	normalize := func(u string) string {
+		u, _, _ = strings.Cut(u, "#")
+		u = strings.TrimPrefix(strings.TrimPrefix(u, "https://"), "http://")
+		u = strings.TrimPrefix(u, "www.")
+		return strings.ToLower(strings.TrimSuffix(u, "/"))
 	}
-	defer resp.Body.Close()
+	return normalize(url) != normalize(finalURL)
+}
 
+// parseFiles parses the source code files in an explorer page. If selector
+// is nil, the default source areas are recognized.
+func parseFiles(r io.Reader, selector *sourceSelector) (*FetchResult, error) {
 	files := map[string]*SourceCodeFile{}
+	result := &FetchResult{Files: files, Libraries: map[string]string{}}
 
-	tokenizer := html.NewTokenizer(resp.Body)
+	tokenizer := html.NewTokenizer(r)
 	fileName := ""
+	fileIndex := 0
+	// values shown next to a label in the page
+	optimization := ""
+	otherSettings := ""
+	labels := map[string]*string{
+		"Contract Name:":        &result.ContractName,
+		"Compiler Version:":     &result.CompilerVersion,
+		"Optimization Enabled:": &optimization,
+		"Other Settings:":       &otherSettings,
+	}
+	var expectedLabel *string
+	expectSimilarMatch := false
+	expectImplementation := false
+	expectSettings := false
+	inLibraries := false
+	libraryName := ""
+	var parseErr error
 	for {
 		tokenType := tokenizer.Next()
 		if tokenType == html.ErrorToken {
-			err := tokenizer.Err()
-			if errors.Is(err, io.EOF) {
-				break
+			if err := tokenizer.Err(); !errors.Is(err, io.EOF) {
+				parseErr = err
 			}
-			panic(err)
+			break
 		}
 
 		if tokenType == html.TextToken {
 			text := string(tokenizer.Text())
+
+			// a label value is either in the same text as its label or in
+			// the next non empty text
+			if expectedLabel != nil && strings.TrimSpace(text) != "" {
+				*expectedLabel = strings.TrimSpace(text)
+				expectedLabel = nil
+			}
+			for label, value := range labels {
+				if *value != "" {
+					continue
+				}
+				if _, v, found := strings.Cut(text, label); found {
+					*value = strings.TrimSpace(v)
+					if *value == "" {
+						expectedLabel = value
+					}
+				}
+			}
+
+			if strings.Contains(text, "Similar Match") {
+				expectSimilarMatch = true
+			}
+
+			if t := strings.TrimSpace(text); t != "" {
+				expectSettings = t == "Settings" || t == "Settings:"
+			}
+
+			if strings.Contains(strings.ToLower(text), "implementation contract at") {
+				expectImplementation = true
+			}
+
+			// libraries are listed as "Name : address", with the address
+			// either in the same text or in a link
+			if strings.Contains(text, "Library Used") || strings.Contains(text, "Libraries Used") {
+				inLibraries = true
+			} else if inLibraries {
+				name, address := parseLibraryText(text)
+				if address != "" {
+					result.Libraries[name] = address
+				}
+				if name != "" || strings.TrimSpace(text) != "" {
+					// a name is only followed by the link of its address
+					libraryName = ""
+					if address == "" {
+						libraryName = name
+					}
+				}
+			}
+
 			if strings.Contains(text, "File ") {
 				fields := strings.Fields(text)
 				fileName = fields[len(fields)-1]
+				fileIndex = parseFileIndex(fields)
 			}
 			continue
 		}
 
+		tagName, _ := tokenizer.TagName()
+		sourceTag := string(tagName)
 		for {
 			k, v, moreAttrs := tokenizer.TagAttr()
-			if string(k) == "class" && bytes.Contains(v, []byte("js-sourcecopyarea")) {
-				if fileName == "" {
-					// not a contract code file
-					break
+			if expectSimilarMatch && result.SimilarMatch == "" && string(k) == "href" {
+				if address := addressFromHref(string(v)); address != "" {
+					result.SimilarMatch = address
+					expectSimilarMatch = false
 				}
+			}
 
-				rawContent := ""
-				thisTokenType := tokenizer.Next()
-				for {
-					if thisTokenType == html.TextToken {
-						rawContent += string(tokenizer.Text())
-					}
+			if expectImplementation && result.Implementation == "" && string(k) == "href" {
+				if address := addressFromHref(string(v)); address != "" {
+					result.Implementation = address
+					expectImplementation = false
+				}
+			}
 
-					thisTokenType = tokenizer.Next()
-					tagName, _ := tokenizer.TagName()
+			if libraryName != "" && string(k) == "href" {
+				if address := addressFromHref(string(v)); address != "" {
+					result.Libraries[libraryName] = strings.ToLower(address)
+					libraryName = ""
+				}
+			}
 
-					if string(tagName) == "pre" && thisTokenType == html.EndTagToken {
-						break
+			if isSourceArea(selector, sourceTag, tokenType, string(k), v) {
+				if fileName == "" {
+					// the settings of a standard JSON input are shown in
+					// a source area after their heading
+					if expectSettings {
+						rawSettings, err := readSourceArea(tokenizer, sourceTag)
+						if err != nil {
+							parseErr = fmt.Errorf("settings: %v", err)
+							break
+						}
+						settings := strings.TrimSpace(rawSettings)
+						if json.Valid([]byte(settings)) && strings.HasPrefix(settings, "{") {
+							result.Settings = json.RawMessage(settings)
+						}
+						expectSettings = false
 					}
+
+					// not a contract code file
+					break
+				}
+
+				rawContent, err := readSourceArea(tokenizer, sourceTag)
+				if err != nil {
+					parseErr = fmt.Errorf("file %s: %v", fileName, err)
+					break
 				}
 
 				file := &SourceCodeFile{
 					Name:       fileName,
 					RawContent: rawContent,
+					Index:      fileIndex,
 				}
 				fillDependenciesAndImports(file)
+				fillPragmaAndLicense(file)
 				files[fileName] = file
 
 				fileName = ""
@@ -94,192 +306,1132 @@ func getFiles(contractAddress string) (map[FileName]*SourceCodeFile, error) {
 				break
 			}
 		}
+
+		// the files after a malformed source element can not be told apart
+		if parseErr != nil {
+			break
+		}
+	}
+
+	fixImportExtensions(files)
+
+	result.OptimizationUsed, result.Runs = parseOptimization(optimization)
+	result.EVMVersion = parseEVMVersion(otherSettings)
+	result.ViaIR = parseViaIR(otherSettings)
+	if len(result.Settings) > 0 {
+		settings := struct {
+			ViaIR bool `json:"viaIR"`
+		}{}
+		if json.Unmarshal(result.Settings, &settings) == nil && settings.ViaIR {
+			result.ViaIR = true
+		}
+	}
+
+	if parseErr != nil {
+		return result, &partialParseError{FileCount: len(files), Err: parseErr}
 	}
 
-	return files, nil
+	return result, nil
 }
 
-func fillDependenciesAndImports(file *SourceCodeFile) {
-	for _, line := range strings.Split(file.RawContent, "\n") {
-		if strings.HasPrefix(strings.TrimSpace(line), "import ") {
+// partialParseError is returned by parseFiles, together with the files
+// read so far, when the page could not be parsed until the end.
+type partialParseError struct {
+	FileCount int
+	Err       error
+}
+
+func (e *partialParseError) Error() string {
+	return fmt.Sprintf("could not parse the whole explorer page, %d files read before the error: %v", e.FileCount, e.Err)
+}
+
+func (e *partialParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseFileIndex returns N from the fields of a "File N of M : Name" text,
+// or 0 if there is no such number.
+func parseFileIndex(fields []string) int {
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] == "File" {
+			if n, err := strconv.Atoi(fields[i+1]); err == nil {
+				return n
+			}
+		}
+	}
+
+	return 0
+}
+
+// parseOptimization parses the optimization settings as shown by the
+// explorer, e.g. "Yes with 200 runs".
+func parseOptimization(optimization string) (bool, int) {
+	fields := strings.Fields(optimization)
+	if len(fields) == 0 {
+		return false, 0
+	}
+
+	used := strings.EqualFold(fields[0], "yes")
+	runs := 0
+	for i := 1; i+1 < len(fields); i++ {
+		if strings.HasPrefix(fields[i+1], "runs") {
+			runs, _ = strconv.Atoi(fields[i])
+		}
+	}
+
+	return used, runs
+}
+
+// parseEVMVersion returns the EVM version from the other settings shown by
+// the explorer, e.g. "paris EvmVersion, MIT license". The "Default" version
+// is reported as "default".
+func parseEVMVersion(otherSettings string) string {
+	fields := strings.Fields(strings.ReplaceAll(otherSettings, ",", " "))
+	for i := 0; i+1 < len(fields); i++ {
+		if strings.EqualFold(fields[i+1], "evmVersion") {
+			return strings.ToLower(fields[i])
+		}
+	}
+
+	return ""
+}
+
+// parseViaIR reports whether the other settings shown by the explorer
+// include the IR pipeline, e.g. "paris EvmVersion, viaIR, MIT license".
+func parseViaIR(otherSettings string) bool {
+	for _, field := range strings.Fields(strings.ReplaceAll(otherSettings, ",", " ")) {
+		if strings.EqualFold(field, "viaIR") || strings.EqualFold(field, "via-ir") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseLibraryText parses a library entry as shown by the explorer, e.g.
+// "SafeMath : 0x1234". The address is empty if the text only has the name
+// and a colon. The name is empty if the text is not a library entry.
+func parseLibraryText(text string) (string, string) {
+	name, address, found := strings.Cut(text, ":")
+	name = strings.TrimSpace(name)
+	address = strings.TrimSpace(address)
+	if !found || name == "" || strings.ContainsAny(name, " \t") {
+		return "", ""
+	}
+
+	if address != "" && !isAddress(address) {
+		return "", ""
+	}
+
+	return name, strings.ToLower(address)
+}
+
+// isAddress reports whether s is a hex encoded address with the 0x prefix.
+func isAddress(s string) bool {
+	if len(s) != 42 || !strings.HasPrefix(s, "0x") {
+		return false
+	}
+	_, err := hex.DecodeString(s[2:])
+	return err == nil
+}
+
+// normalizeAddress trims the spaces around an address, as pasted from
+// other tools, and lowercases it, so that the same contract always gets the
+// same URL and directory.
+func normalizeAddress(s string) (string, error) {
+	address := strings.ToLower(strings.TrimSpace(s))
+	if !isAddress(address) {
+		return "", fmt.Errorf("invalid address '%s'", strings.TrimSpace(s))
+	}
+	return address, nil
+}
+
+// addressFromHref returns the address of an explorer address link such as
+// /address/0x1234#code, or an empty string if the link is not one.
+func addressFromHref(href string) string {
+	_, address, found := strings.Cut(href, "/address/")
+	if !found {
+		return ""
+	}
+
+	if i := strings.IndexAny(address, "#?/"); i >= 0 {
+		address = address[:i]
+	}
+	if !strings.HasPrefix(address, "0x") {
+		return ""
+	}
+
+	return address
+}
+
+// sourceSelector identifies the elements holding source code by an
+// attribute containing a value.
+type sourceSelector struct {
+	Attr  string
+	Value string
+}
+
+// parseSourceSelector parses a selector written as ATTR=VALUE, or just
+// VALUE to match the class attribute.
+func parseSourceSelector(selector string) (*sourceSelector, error) {
+	attr, value, found := strings.Cut(selector, "=")
+	if !found {
+		attr, value = "class", selector
+	}
+
+	if attr == "" || value == "" {
+		return nil, fmt.Errorf("invalid source selector '%s', expected ATTR=VALUE or a class name", selector)
+	}
+
+	return &sourceSelector{Attr: strings.ToLower(attr), Value: value}, nil
+}
+
+// isSourceArea reports whether the attribute identifies an element holding
+// the source code of a file. Depending on the explorer version, the source
+// is either in a pre or in a textarea element. A selector replaces the
+// default rules.
+func isSourceArea(selector *sourceSelector, tagName string, tokenType html.TokenType, key string, value []byte) bool {
+	if tokenType != html.StartTagToken {
+		return false
+	}
+
+	if selector != nil {
+		return key == selector.Attr && bytes.Contains(value, []byte(selector.Value))
+	}
+
+	if key == "class" && bytes.Contains(value, []byte("js-sourcecopyarea")) {
+		return true
+	}
+
+	return tagName == "textarea" && key == "id" && bytes.HasPrefix(value, []byte("editor"))
+}
+
+// gutterClasses are the classes of the elements that some layouts add to
+// the source code element to show the line numbers.
+var gutterClasses = []string{"lineno", "linenos", "line-number", "line-numbers", "linenumber", "gutter"}
+
+// isGutter reports whether the tag the tokenizer is positioned at is a line
+// numbers element.
+func isGutter(tokenizer *html.Tokenizer, hasAttr bool) bool {
+	for hasAttr {
+		var key, value []byte
+		key, value, hasAttr = tokenizer.TagAttr()
+		if string(key) != "class" {
+			continue
+		}
+		for _, class := range strings.Fields(string(value)) {
+			if slices.Contains(gutterClasses, class) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// voidElements are the HTML elements without an end tag, which must not be
+// counted as nesting inside a line numbers element.
+var voidElements = []string{"area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "source", "track", "wbr"}
+
+// maxSourceAreaTokens bounds the tokens read from a source code element,
+// far above what the largest verified contracts produce.
+const maxSourceAreaTokens = 1 << 20
+
+// readSourceArea reads the content of the source code element the
+// tokenizer is positioned at, until its closing tag. Line breaks rendered
+// as br tags, and the ends of the items of layouts that show each line as
+// an item of a list (linenums), are kept as newlines. Line numbers
+// elements are left out. It fails if the page ends, or the tokenizer
+// reads too many tokens, before the closing tag, as with malformed pages.
+func readSourceArea(tokenizer *html.Tokenizer, sourceTag string) (string, error) {
+	rawContent := &strings.Builder{}
+	gutterDepth := 0
+	for tokens := 0; ; tokens++ {
+		if tokens == maxSourceAreaTokens {
+			return "", fmt.Errorf("the <%s> source element is not closed after %d tokens", sourceTag, maxSourceAreaTokens)
+		}
+
+		thisTokenType := tokenizer.Next()
+		if thisTokenType == html.ErrorToken {
+			if err := tokenizer.Err(); !errors.Is(err, io.EOF) {
+				return "", err
+			}
+			return "", fmt.Errorf("the page ends before the <%s> source element is closed", sourceTag)
+		}
+
+		if thisTokenType == html.TextToken {
+			if gutterDepth == 0 {
+				rawContent.Write(tokenizer.Text())
+			}
+			continue
+		}
+
+		tagName, hasAttr := tokenizer.TagName()
+		isVoid := slices.Contains(voidElements, string(tagName))
+		if gutterDepth > 0 {
+			switch {
+			case thisTokenType == html.StartTagToken && !isVoid:
+				gutterDepth++
+			case thisTokenType == html.EndTagToken && !isVoid:
+				gutterDepth--
+			}
+			continue
+		}
+
+		if string(tagName) == "br" && (thisTokenType == html.StartTagToken || thisTokenType == html.SelfClosingTagToken) {
+			rawContent.WriteString("\n")
+			continue
+		}
+
+		if thisTokenType == html.StartTagToken && !isVoid && isGutter(tokenizer, hasAttr) {
+			gutterDepth = 1
+			continue
+		}
+
+		if string(tagName) == "li" && thisTokenType == html.EndTagToken && !strings.HasSuffix(rawContent.String(), "\n") {
+			rawContent.WriteString("\n")
+			continue
+		}
+
+		if string(tagName) == sourceTag && thisTokenType == html.EndTagToken {
+			return rawContent.String(), nil
+		}
+	}
+}
+
+// entryFile returns the file holding the main contract. The contract name
+// given by the user takes precedence over the one found in the explorer
+// page. It returns nil if there is no contract name to look for.
+func entryFile(result *FetchResult, contractName string) (*SourceCodeFile, error) {
+	name := contractName
+	if name == "" {
+		name = result.ContractName
+	}
+	if name == "" {
+		return nil, nil
+	}
+
+	if f, ok := result.Files[name+".sol"]; ok {
+		return f, nil
+	}
+
+	names := make([]FileName, 0, len(result.Files))
+	for n := range result.Files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		f := result.Files[n]
+		for _, line := range strings.Split(f.RawContent, "\n") {
 			fields := strings.Fields(line)
-			importedFilePath := strings.Trim(fields[len(fields)-1], `'";`)
+			for i := 0; i+1 < len(fields); i++ {
+				if (fields[i] == "contract" || fields[i] == "library") && strings.TrimRight(fields[i+1], "{") == name {
+					return f, nil
+				}
+			}
+		}
+	}
+
+	if contractName != "" {
+		return nil, fmt.Errorf("could not find contract '%s' in any file", contractName)
+	}
+
+	return nil, nil
+}
+
+// ownFiles returns the files reachable from entry through relative
+// imports, which are the sources of the project itself. Files reachable
+// only through package imports are vendored dependencies and are left out.
+func ownFiles(files map[FileName]*SourceCodeFile, entry *SourceCodeFile) map[FileName]*SourceCodeFile {
+	own := map[FileName]*SourceCodeFile{entry.Name: entry}
+	pending := []*SourceCodeFile{entry}
+	for len(pending) > 0 {
+		file := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		for _, imp := range file.Imports {
+			if !strings.HasPrefix(imp, "./") && !strings.HasPrefix(imp, "../") {
+				continue
+			}
+
+			f, err := resolveImport(file, imp, files)
+			if err != nil || own[f.Name] != nil {
+				continue
+			}
+			own[f.Name] = f
+			pending = append(pending, f)
+		}
+	}
+
+	return own
+}
+
+// nonPackageFiles returns the files whose path does not look vendored,
+// that is, it does not start with a scope like "@openzeppelin",
+// node_modules or lib. Files without a complete path are kept.
+func nonPackageFiles(files map[FileName]*SourceCodeFile) map[FileName]*SourceCodeFile {
+	kept := map[FileName]*SourceCodeFile{}
+	for name, f := range files {
+		relPath, err := outputPath(f)
+		if err == nil && isPackageImport(relPath) {
+			continue
+		}
+		kept[name] = f
+	}
+
+	return kept
+}
+
+func fillDependenciesAndImports(file *SourceCodeFile) {
+	seen := map[string]bool{}
+	lines := strings.Split(file.RawContent, "\n")
+	imports := importLines(file.Name, lines)
+	for i := 0; i < len(lines); i++ {
+		if imports[i] {
+			var statement string
+			statement, i = importStatement(lines, i)
+			importedFilePath := cleanImportPath(parseImportPath(statement))
+
+			// only the first import of a path is kept
+			if seen[importedFilePath] {
+				continue
+			}
+			seen[importedFilePath] = true
+
+			if isURLImport(importedFilePath) {
+				file.RemoteImports = append(file.RemoteImports, importedFilePath)
+				continue
+			}
+
 			importedFilePathFields := strings.Split(importedFilePath, "/")
 			importedFilePathName := importedFilePathFields[len(importedFilePathFields)-1]
 
+			// a file importing itself does not say anything about its
+			// location. The name is matched like resolveImport does, so
+			// that "./Self" in Self.sol is a self import too
+			if _, self := matchFileName(importedFilePathName, map[FileName]*SourceCodeFile{file.Name: file}); self {
+				warnf("file %s imports itself ('%s'), ignoring the import", file.Name, importedFilePath)
+				continue
+			}
+
 			file.Imports = append(file.Imports, importedFilePath)
 			file.Dependencies = append(file.Dependencies, importedFilePathName)
 		}
 	}
 }
 
-func fillPaths(files map[FileName]*SourceCodeFile) error {
-	// Create a mapping to determine which files depend on a specific file
-	dependents := map[FileName][]*SourceCodeFile{}
+func fillPragmaAndLicense(file *SourceCodeFile) {
+	for _, line := range strings.Split(file.RawContent, "\n") {
+		line = strings.TrimSpace(line)
 
-	for _, file := range files {
-		for _, dependency := range file.Dependencies {
-			dependents[dependency] = append(dependents[dependency], file)
+		if file.Pragma == "" && strings.HasPrefix(line, "pragma solidity ") {
+			file.Pragma = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "pragma solidity "), ";"))
+		}
+
+		if strings.HasPrefix(line, "pragma experimental ") || strings.HasPrefix(line, "pragma abicoder ") {
+			pragma := strings.Join(strings.Fields(strings.TrimSuffix(strings.TrimPrefix(line, "pragma "), ";")), " ")
+			if !slices.Contains(file.OtherPragmas, pragma) {
+				file.OtherPragmas = append(file.OtherPragmas, pragma)
+			}
 		}
+
+		if file.License == "" {
+			if _, license, found := strings.Cut(line, "SPDX-License-Identifier:"); found {
+				file.License = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(license), "*/"))
+			}
+		}
+	}
+}
+
+// isImportLine reports whether the line starts an import statement. The
+// import keyword must not be followed by an identifier character, so that
+// "import\t\"x\"" and "import{A} from \"x\"" are imports and "importantThing()"
+// is not.
+func isImportLine(line string) bool {
+	rest, found := strings.CutPrefix(strings.TrimSpace(line), "import")
+	if !found || rest == "" {
+		return false
 	}
 
-	totalDone := 0
-	for {
-		done := 0
-		for _, file := range files {
-			if err := fillPathForFile(file, dependents, map[FileName]bool{}, files); err != nil {
-				return err
+	r, _ := utf8.DecodeRuneInString(rest)
+	return r != '_' && r != '$' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// importLines reports for each line of a file whether it is an import
+// statement. Lines inside block comments and assembly blocks are not, even
+// if they look like one, and Yul files do not have imports.
+func importLines(name FileName, lines []string) []bool {
+	imports := make([]bool, len(lines))
+	if path.Ext(name) == ".yul" {
+		return imports
+	}
+
+	inComment := false
+	assemblyDepth := 0
+	pendingAssembly := false
+	for n, line := range lines {
+		imports[n] = !inComment && assemblyDepth == 0 && isImportLine(line)
+
+		var quote byte
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			next := byte(0)
+			if i+1 < len(line) {
+				next = line[i+1]
 			}
 
-			if len(file.PathFields) > 0 && file.PathFields[0] != rootDirName {
-				done++
+			switch {
+			case inComment:
+				if c == '*' && next == '/' {
+					inComment = false
+					i++
+				}
+			case quote != 0:
+				if c == '\\' {
+					i++
+				} else if c == quote {
+					quote = 0
+				}
+			case c == '/' && next == '/':
+				i = len(line)
+			case c == '/' && next == '*':
+				inComment = true
+				i++
+			case c == '"' || c == '\'':
+				quote = c
+			case c == '{':
+				if assemblyDepth > 0 {
+					assemblyDepth++
+				} else if pendingAssembly {
+					assemblyDepth = 1
+					pendingAssembly = false
+				}
+			case c == '}':
+				if assemblyDepth > 0 {
+					assemblyDepth--
+				}
+			case c == '_' || c == '$' || unicode.IsLetter(rune(c)):
+				start := i
+				for i+1 < len(line) && (line[i+1] == '_' || line[i+1] == '$' || unicode.IsLetter(rune(line[i+1])) || unicode.IsDigit(rune(line[i+1]))) {
+					i++
+				}
+				if line[start:i+1] == "assembly" && assemblyDepth == 0 {
+					pendingAssembly = true
+				}
 			}
 		}
+	}
+
+	return imports
+}
+
+// importStatement joins the lines of the import statement starting at
+// line start, since statements like "import {\n\tA\n} from \"./A.sol\";"
+// span several lines, and returns it with the index of its last line. A
+// statement missing its semicolon ends before the next import line.
+func importStatement(lines []string, start int) (string, int) {
+	end := start
+	for end+1 < len(lines) && !strings.Contains(lines[end], ";") && !isImportLine(lines[end+1]) {
+		end++
+	}
+
+	return strings.Join(lines[start:end+1], "\n"), end
+}
 
-		// track if new paths where found. If not, there is nothing left to do
-		if done == totalDone {
+// cleanImportPath normalizes the segments of an import path, so that
+// "../utils/../token/Foo.sol" becomes "../token/Foo.sol". Relative paths
+// keep their leading "./" and URLs are not changed.
+func cleanImportPath(importPath string) string {
+	if importPath == "" || isURLImport(importPath) {
+		return importPath
+	}
+
+	cleaned := path.Clean(importPath)
+	if (strings.HasPrefix(importPath, "./") || strings.HasPrefix(importPath, "../")) &&
+		cleaned != ".." && !strings.HasPrefix(cleaned, "../") {
+		cleaned = "./" + cleaned
+	}
+
+	return cleaned
+}
+
+// parseImportPath returns the path of an import statement. The path is the
+// content of the first quoted string in the statement, so paths containing
+// spaces are kept whole. If the line has no quoted string, a field is used
+// instead: the one after "from" in the "import * as Name from path"
+// and "import {Name} from path" forms, or the one after "import" in the
+// "import path as Name" form, so that aliases are not taken as paths.
+func parseImportPath(line string) string {
+	start := strings.IndexAny(line, `'"`)
+	if start >= 0 {
+		end := strings.IndexByte(line[start+1:], line[start])
+		if end >= 0 {
+			return line[start+1 : start+1+end]
+		}
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	pathField := fields[len(fields)-1]
+	if len(fields) > 2 && fields[0] == "import" && fields[2] == "as" && fields[1] != "*" {
+		pathField = fields[1]
+	}
+	for i, field := range fields {
+		if field == "from" && i+1 < len(fields) {
+			pathField = fields[i+1]
 			break
 		}
-		totalDone = done
 	}
 
-	return nil
+	return strings.Trim(pathField, `'";`)
 }
 
-func fillPathForFile(file *SourceCodeFile, dependents map[FileName][]*SourceCodeFile, callstack map[FileName]bool, files map[string]*SourceCodeFile) error {
-	if callstack[file.Name] {
-		return nil
+const (
+	// pathStrategyLongest keeps the longest path suggested by the
+	// dependents of a file
+	pathStrategyLongest string = "longest"
+
+	// pathStrategyFrequent keeps the path suggested by most of the
+	// dependents of a file
+	pathStrategyFrequent string = "frequent"
+)
+
+const (
+	// importStyleRoot resolves the imports that are neither relative nor
+	// clearly packages from the root of the project, as solc does
+	importStyleRoot string = "root"
+
+	// importStyleRelative resolves them from the directory of the
+	// importing file, for projects that leave out the leading "./"
+	importStyleRelative string = "relative"
+)
+
+type pathOptions struct {
+	Strategy string
+
+	// Remappings are the solc remappings of the project, used to place the
+	// files imported with package imports.
+	Remappings []remapping
+
+	// ImportStyle is how ambiguous imports are resolved, importStyleRoot
+	// if empty.
+	ImportStyle string
+
+	// Learned are the paths of the files known from a previous run, by
+	// name, relative to the root. They are pinned instead of inferred.
+	Learned map[FileName]string
+
+	// MaxDepth is the maximum number of directories of the inferred
+	// paths, 0 for no limit. Deeper paths only come from malformed
+	// imports.
+	MaxDepth int
+
+	// depthWarnings are the warnings about MaxDepth already printed, as
+	// the same import is seen in every pass
+	depthWarnings map[string]bool
+}
+
+// tooDeep reports whether depth is over MaxDepth, and warns about it once.
+func (opts pathOptions) tooDeep(depth int, format string, args ...any) bool {
+	if opts.MaxDepth <= 0 || depth <= opts.MaxDepth {
+		return false
 	}
 
-	callstack[file.Name] = true
-	defer func() { callstack[file.Name] = false }()
+	message := fmt.Sprintf(format, args...)
+	if !opts.depthWarnings[message] {
+		opts.depthWarnings[message] = true
+		warnf("%s", message)
+	}
+	return true
+}
 
-	if len(file.PathFields) > 0 && file.PathFields[0] == rootDirName {
-		return nil
+func fillPaths(files map[FileName]*SourceCodeFile, opts pathOptions) error {
+	if opts.Strategy != pathStrategyLongest && opts.Strategy != pathStrategyFrequent {
+		return fmt.Errorf("unknown path strategy '%s'", opts.Strategy)
 	}
 
-	// if no other file imports this file, try determining this file's path
-	// using its imports
-	if len(dependents[file.Name]) == 0 {
-		// check if the path can be determined with the siblings in the import list
-		for _, imp := range file.Imports {
-			impFields := strings.Split(imp, "/")
-			f, ok := files[impFields[len(impFields)-1]]
-			if !ok {
-				panic("unexpected file")
-			}
-			err := fillPathForFile(f, dependents, callstack, files)
-			if err != nil {
-				return err
-			}
+	switch opts.ImportStyle {
+	case "", importStyleRoot, importStyleRelative:
+	default:
+		return fmt.Errorf("unknown import style '%s'", opts.ImportStyle)
+	}
 
-			if len(f.PathFields) > 0 {
-				file.PathFields = append([]string{}, f.PathFields...)
-			}
+	opts.depthWarnings = map[string]bool{}
 
-			if impFields[0] == ".." {
-				for i := 0; i < len(impFields) && impFields[i] == ".."; i++ {
-					file.PathFields = append(file.PathFields, "dummy")
-				}
-			}
+	for name, relPath := range opts.Learned {
+		file, ok := files[name]
+		if !ok {
+			warnf("learned path of %s does not match any file, ignoring it", name)
+			continue
+		}
+		file.PathFields = learnedPathFields(relPath)
+		file.Confidence = confidenceAuthoritative
+	}
 
-			if len(file.PathFields) > 0 {
-				return nil
+	// without imports there is no information about the directory
+	// structure, so all files are placed at the root
+	hasImports := false
+	for _, file := range files {
+		if len(file.Imports) > 0 {
+			hasImports = true
+			break
+		}
+	}
+	if !hasImports {
+		for _, file := range files {
+			if _, ok := opts.Learned[file.Name]; ok {
+				continue
 			}
+			file.PathFields = []string{rootDirName}
+			file.Confidence = confidenceInferred
+		}
+		return nil
+	}
+
+	names := make([]FileName, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Create a mapping to determine which files depend on a specific file.
+	// Files are visited by name, so the dependents of each file are sorted
+	// and the result does not depend on the order of the map
+	dependents := map[FileName][]*SourceCodeFile{}
+	for _, name := range names {
+		file := files[name]
+		for _, dependency := range file.Dependencies {
+			dependents[dependency] = append(dependents[dependency], file)
+		}
+	}
+
+	// the paths are propagated until nothing changes. When files are left
+	// without a path, one of them is placed with a guess and the paths are
+	// propagated again from it
+	for {
+		if err := propagatePaths(names, dependents, files, opts); err != nil {
+			return err
+		}
+
+		file := fallbackFile(names, dependents, files)
+		if file == nil {
+			break
 		}
 
-		// if the path could not be determined with the siblings,
 		// find out how many dirs deep this file should be located
 		// and add that amount of dummy dirs to the path
-		file.PathFields = append(file.PathFields, rootDirName)
 		parentsCount := countParentDirsFromImports(file, files, map[string]bool{})
 		count := 0
 		if parentsCount != nil {
 			count = *parentsCount
 		}
+		if opts.tooDeep(count, "the imports of %s place it %d directories deep, capping it at -max-depth %d", file.Name, count, opts.MaxDepth) {
+			count = opts.MaxDepth
+		}
+		file.PathFields = []string{rootDirName}
 		for i := 0; i < count; i++ {
-			file.PathFields = append(file.PathFields, "dummy")
+			file.PathFields = append(file.PathFields, placeholderDirName)
 		}
+	}
 
-		return nil
+	for _, file := range files {
+		if _, ok := opts.Learned[file.Name]; !ok {
+			file.Confidence = pathConfidence(file)
+		}
+	}
+
+	return nil
+}
+
+// propagatePaths infers the path of every file from the current paths of
+// the files importing it, or else of the files it imports, in passes over
+// the files sorted by name, until a pass does not change any path. Every
+// path is inferred again in each pass, so that it takes into account the
+// files placed after it. The passes are bounded for the bundles whose
+// imports contradict each other, where the paths may never settle.
+func propagatePaths(names []FileName, dependents map[FileName][]*SourceCodeFile, files map[FileName]*SourceCodeFile, opts pathOptions) error {
+	maxPasses := 2*len(names) + 2
+	for pass := 0; pass < maxPasses; pass++ {
+		changed := false
+		for _, name := range names {
+			file := files[name]
+			if _, ok := opts.Learned[name]; ok {
+				continue
+			}
+
+			pathFields, err := inferPath(file, dependents, files, opts)
+			if err != nil {
+				return err
+			}
+			if pathFields != nil && !slices.Equal(pathFields, file.PathFields) {
+				file.PathFields = pathFields
+				changed = true
+			}
+		}
+
+		if !changed {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// fallbackFile returns the file to place with a guess when the paths can
+// not be propagated any further, or nil if every file has a path. Files
+// that no other file imports are preferred, as they are usually the entry
+// points of the project, and among them the ones that do not import
+// parent directories, which can be placed at the root.
+func fallbackFile(names []FileName, dependents map[FileName][]*SourceCodeFile, files map[FileName]*SourceCodeFile) *SourceCodeFile {
+	var best *SourceCodeFile
+	bestCount := 0
+	for _, name := range names {
+		file := files[name]
+		if len(file.PathFields) > 0 || len(dependents[name]) > 0 {
+			continue
+		}
+
+		count := 0
+		if parentsCount := countParentDirsFromImports(file, files, map[string]bool{}); parentsCount != nil {
+			count = *parentsCount
+		}
+		if best == nil || count < bestCount {
+			best = file
+			bestCount = count
+		}
+	}
+	if best != nil {
+		return best
+	}
+
+	// only files importing each other are left
+	for _, name := range names {
+		if len(files[name].PathFields) == 0 {
+			return files[name]
+		}
+	}
+
+	return nil
+}
+
+// pathConfidence returns the confidence of an inferred path: guessed when
+// it is incomplete or has placeholder directories, inferred otherwise.
+func pathConfidence(file *SourceCodeFile) string {
+	if len(file.PathFields) == 0 || file.PathFields[0] != rootDirName || slices.Contains(file.PathFields, placeholderDirName) {
+		return confidenceGuessed
+	}
+	return confidenceInferred
+}
+
+// errNoPathResolved is reported when fillPaths could not place any file,
+// as writing them would then fail for every file without telling why.
+var errNoPathResolved = errors.New("could not resolve any file's path; the bundle may be incomplete or use an unsupported import style")
+
+// anyPathResolved reports whether at least one file has a complete path.
+func anyPathResolved(files map[FileName]*SourceCodeFile) bool {
+	for _, f := range files {
+		if len(f.PathFields) > 0 && f.PathFields[0] == rootDirName {
+			return true
+		}
 	}
+	return false
+}
 
+// inferPath returns the path of a file suggested by the files importing
+// it that have a path, chosen with the path strategy. If there are none,
+// the path is taken from the files it imports that have a path. It returns
+// nil if the path can not be inferred yet.
+func inferPath(file *SourceCodeFile, dependents map[FileName][]*SourceCodeFile, files map[FileName]*SourceCodeFile, opts pathOptions) ([]string, error) {
+	var best []string
+	suggestions := map[string]int{}
 	for _, dependentFile := range dependents[file.Name] {
-		err := fillPathForFile(dependentFile, dependents, callstack, files)
+		newPathFields, ok, err := dependentSuggestion(file, dependentFile, files, opts)
 		if err != nil {
-			return err
+			return nil, err
 		}
-
-		if len(dependentFile.PathFields) == 0 {
+		if !ok {
 			continue
 		}
 
-		// find out how the dependent is importing this file
-		// get the index in the import array
-		found := false
-		importIndex := 0
-		for i, dependency := range dependentFile.Dependencies {
-			if dependency == file.Name {
-				importIndex = i
-				found = true
-			}
+		if opts.Strategy == pathStrategyFrequent {
+			suggestions[strings.Join(newPathFields, "/")]++
+			continue
 		}
 
-		if !found {
-			return fmt.Errorf(
-				"could not find file '%s' in dependent's array of dependencies (Dependent: %s)",
-				file.Name,
-				dependentFile.Name)
+		// always keep the longer path
+		if best == nil || longerPath(newPathFields, best) {
+			best = newPathFields
 		}
+	}
 
-		importPath := dependentFile.Imports[importIndex]
-		importPathFields := strings.Split(importPath, "/")
-		importPathFields = importPathFields[:len(importPathFields)-1]
+	if len(suggestions) > 0 {
+		return strings.Split(mostFrequentPath(suggestions), "/"), nil
+	}
+	if best != nil {
+		return best, nil
+	}
 
-		newPathFields := []string{}
-		if importPathFields[0] == ".." {
-			parentsCount := 0
-			for i := 0; i < len(importPathFields) && importPathFields[i] == ".."; i++ {
-				parentsCount++
-			}
+	// check if the path can be determined with the files in the import
+	// list, keeping the most specific of the paths they suggest
+	for _, imp := range file.Imports {
+		f, err := resolveImport(file, imp, files)
+		if err != nil {
+			// a file missing from the bundle does not tell anything
+			// about the path, and it is reported with the other
+			// unresolved imports
+			continue
+		}
 
-			if parentsCount >= len(dependentFile.PathFields) {
+		if pathFields, ok := importerPath(f.PathFields, imp); ok {
+			if opts.tooDeep(len(pathFields)-1, "import '%s' of %s places it %d directories deep, over -max-depth %d, ignoring it", imp, file.Name, len(pathFields)-1, opts.MaxDepth) {
 				continue
 			}
+			if best == nil || longerPath(pathFields, best) {
+				best = pathFields
+			}
+		}
+	}
+
+	return best, nil
+}
+
+// dependentSuggestion returns the path of file implied by the way the
+// dependent file imports it, if the dependent has a path or the import
+// does not depend on it.
+func dependentSuggestion(file, dependentFile *SourceCodeFile, files map[FileName]*SourceCodeFile, opts pathOptions) ([]string, bool, error) {
+	if len(dependentFile.PathFields) == 0 {
+		return nil, false, nil
+	}
+
+	// find out how the dependent is importing this file
+	// get the index in the import array
+	importIndex := slices.Index(dependentFile.Dependencies, file.Name)
+	if importIndex < 0 {
+		return nil, false, fmt.Errorf(
+			"could not find file '%s' in dependent's array of dependencies (Dependent: %s)",
+			file.Name,
+			dependentFile.Name)
+	}
 
-			newPathFields = append([]string{}, dependentFile.PathFields[:len(dependentFile.PathFields)-parentsCount]...)
-			newPathFields = append(newPathFields, importPathFields[parentsCount:]...)
-		} else if importPathFields[0] == "." {
-			newPathFields = append([]string{}, dependentFile.PathFields...)
-			newPathFields = append(newPathFields, importPathFields[1:]...)
-		} else {
-			newPathFields = append([]string{rootDirName}, importPathFields...)
+	importPath := dependentFile.Imports[importIndex]
+	importPathFields := strings.Split(importPath, "/")
+	importPathFields = importPathFields[:len(importPathFields)-1]
+
+	newPathFields := []string{}
+	if len(importPathFields) == 0 {
+		// a bare file name is taken as a sibling of the importer
+		newPathFields = append([]string{}, dependentFile.PathFields...)
+	} else if importPathFields[0] == ".." {
+		parentsCount := 0
+		for i := 0; i < len(importPathFields) && importPathFields[i] == ".."; i++ {
+			parentsCount++
+		}
+		subdirs := importPathFields[parentsCount:]
+		if opts.tooDeep(parentsCount, "import '%s' of %s goes up %d directories, capping it at -max-depth %d", importPath, dependentFile.Name, parentsCount, opts.MaxDepth) {
+			parentsCount = opts.MaxDepth
 		}
 
-		// always keep the longer path
-		if len(newPathFields) >= len(file.PathFields) {
-			file.PathFields = newPathFields
+		if parentsCount >= len(dependentFile.PathFields) {
+			if dependentFile.PathFields[0] != rootDirName {
+				return nil, false, nil
+			}
+
+			// the import goes above the root, so the root is actually
+			// higher up in the tree
+			extendRoot(files, parentsCount-len(dependentFile.PathFields)+1)
 		}
+
+		newPathFields = append([]string{}, dependentFile.PathFields[:len(dependentFile.PathFields)-parentsCount]...)
+		newPathFields = append(newPathFields, subdirs...)
+	} else if importPathFields[0] == "." {
+		newPathFields = append([]string{}, dependentFile.PathFields...)
+		newPathFields = append(newPathFields, importPathFields[1:]...)
+	} else if remappedPath, ok := applyRemappings(importPath, opts.Remappings); ok {
+		// package imports are relative to the root, after applying the
+		// remappings of the project
+		remappedFields := strings.Split(path.Clean(remappedPath), "/")
+		newPathFields = append([]string{rootDirName}, remappedFields[:len(remappedFields)-1]...)
+	} else if opts.ImportStyle == importStyleRelative && !isPackageImport(importPath) {
+		newPathFields = append([]string{}, dependentFile.PathFields...)
+		newPathFields = append(newPathFields, importPathFields...)
+	} else {
+		newPathFields = append([]string{rootDirName}, importPathFields...)
 	}
 
-	return nil
+	return newPathFields, true, nil
+}
+
+// importerPath returns the path fields of a file that imports, with the
+// relative import imp, a file with the given path fields. The directories
+// left by ".." are unknown, so placeholders are used for them. It fails if
+// the imported path is unknown or does not match the import, and for non
+// relative imports, which do not depend on the location of the importer.
+func importerPath(importedFields []string, imp string) ([]string, bool) {
+	if len(importedFields) == 0 {
+		return nil, false
+	}
+
+	impFields := strings.Split(imp, "/")
+	impFields = impFields[:len(impFields)-1]
+	if len(impFields) == 0 {
+		// a bare file name is a sibling of the importer
+		return append([]string{}, importedFields...), true
+	}
+
+	if impFields[0] == "." {
+		impFields = impFields[1:]
+	} else if impFields[0] != ".." {
+		return nil, false
+	}
+
+	parentsCount := 0
+	for parentsCount < len(impFields) && impFields[parentsCount] == ".." {
+		parentsCount++
+	}
+	subdirs := impFields[parentsCount:]
+
+	// the root can not be removed
+	keep := len(importedFields) - len(subdirs)
+	if keep < 1 {
+		return nil, false
+	}
+	for i, subdir := range subdirs {
+		if importedFields[keep+i] != subdir && importedFields[keep+i] != placeholderDirName {
+			return nil, false
+		}
+	}
+
+	pathFields := append([]string{}, importedFields[:keep]...)
+	for i := 0; i < parentsCount; i++ {
+		pathFields = append(pathFields, placeholderDirName)
+	}
+
+	return pathFields, true
+}
+
+// longerPath reports whether the candidate path fields are preferred over
+// the current ones by the longest path strategy. Ties are broken by
+// preferring the paths with fewer placeholder directories, then complete
+// paths, and then the lexicographically smaller path, so that the result
+// does not depend on the order of the dependents.
+func longerPath(candidate, current []string) bool {
+	if len(candidate) != len(current) {
+		return len(candidate) > len(current)
+	}
+
+	candidatePlaceholders := countPlaceholders(candidate)
+	currentPlaceholders := countPlaceholders(current)
+	if candidatePlaceholders != currentPlaceholders {
+		return candidatePlaceholders < currentPlaceholders
+	}
+
+	candidateComplete := len(candidate) > 0 && candidate[0] == rootDirName
+	currentComplete := len(current) > 0 && current[0] == rootDirName
+	if candidateComplete != currentComplete {
+		return candidateComplete
+	}
+
+	return slices.Compare(candidate, current) < 0
+}
+
+// countPlaceholders returns the number of placeholder directories in the
+// path fields.
+func countPlaceholders(pathFields []string) int {
+	count := 0
+	for _, field := range pathFields {
+		if field == placeholderDirName {
+			count++
+		}
+	}
+	return count
+}
+
+// isPackageImport reports whether a non relative import clearly refers to
+// a package, like "@openzeppelin/contracts/..." or a path inside
+// node_modules or lib.
+func isPackageImport(importPath string) bool {
+	first, _, _ := strings.Cut(importPath, "/")
+	return strings.HasPrefix(first, "@") || first == "node_modules" || first == "lib"
+}
+
+// extendRoot moves every file with a complete path the given amount of
+// levels down from the root, keeping their relative locations.
+func extendRoot(files map[FileName]*SourceCodeFile, levels int) {
+	for _, f := range files {
+		if len(f.PathFields) == 0 || f.PathFields[0] != rootDirName {
+			continue
+		}
+
+		newPathFields := []string{rootDirName}
+		for i := 0; i < levels; i++ {
+			newPathFields = append(newPathFields, placeholderDirName)
+		}
+		f.PathFields = append(newPathFields, f.PathFields[1:]...)
+	}
+}
+
+// mostFrequentPath returns the path with the highest count. Ties are broken
+// by keeping the longer path, and then the lexicographically smaller one.
+func mostFrequentPath(suggestions map[string]int) string {
+	best := ""
+	bestCount := 0
+	for p, count := range suggestions {
+		if count < bestCount {
+			continue
+		}
+
+		if count == bestCount {
+			pLen, bestLen := strings.Count(p, "/"), strings.Count(best, "/")
+			if pLen < bestLen || (pLen == bestLen && p > best) {
+				continue
+			}
+		}
+
+		best = p
+		bestCount = count
+	}
+
+	return best
 }
 
-func addBasePathToImports(files map[FileName]*SourceCodeFile, basePath string) {
+// addBasePathToImports rewrites the import lines of every file. Imports
+// matching one of the remappings are rewritten with it, and the remaining
+// non relative imports get the base path prepended, if any.
+func addBasePathToImports(files map[FileName]*SourceCodeFile, basePath string, remappings []remapping) {
 	for _, file := range files {
 		newRawLines := []string{}
-		for _, line := range strings.Split(file.RawContent, "\n") {
-			// only interested in import lines
-			if !strings.HasPrefix(strings.TrimSpace(line), "import") {
-				newRawLines = append(newRawLines, line)
+		lines := strings.Split(file.RawContent, "\n")
+		imports := importLines(file.Name, lines)
+		for i := 0; i < len(lines); i++ {
+			// only interested in import statements
+			if !imports[i] {
+				newRawLines = append(newRawLines, lines[i])
+				continue
+			}
+
+			var line string
+			line, i = importStatement(lines, i)
+			importPath := parseImportPath(line)
+
+			if remappedPath, ok := applyRemappings(importPath, remappings); ok {
+				newRawLines = append(newRawLines, strings.Replace(line, importPath, remappedPath, 1))
 				continue
 			}
 
-			importLineFields := strings.Fields(strings.TrimSpace(line))
-			importPath := strings.Trim(importLineFields[len(importLineFields)-1], `'";`)
+			// relative and URL imports do not have to be added the basePath
+			if basePath == "" || strings.HasPrefix(importPath, ".") || isURLImport(importPath) {
+				newRawLines = append(newRawLines, line)
+				continue
+			}
 
-			// relative imports do not have to be added the basePath
-			if strings.HasPrefix(importPath, ".") {
+			// imports that already carry the base path are kept as they
+			// are to avoid doubled prefixes
+			cleanBasePath := path.Clean(basePath)
+			if importPath == cleanBasePath || strings.HasPrefix(importPath, cleanBasePath+"/") {
+				warnf("import '%s' in %s already starts with base path '%s', not adding it again", importPath, file.Name, basePath)
 				newRawLines = append(newRawLines, line)
 				continue
 			}
@@ -293,6 +1445,111 @@ func addBasePathToImports(files map[FileName]*SourceCodeFile, basePath string) {
 	}
 }
 
+// makeImportsAbsolute rewrites the relative imports of every file to the
+// path of the imported file from the root of the tree, e.g. "../Foo.sol"
+// to "contracts/Foo.sol". Imports of files without a complete path are
+// kept as they are.
+func makeImportsAbsolute(files map[FileName]*SourceCodeFile) {
+	for _, file := range files {
+		newRawLines := []string{}
+		lines := strings.Split(file.RawContent, "\n")
+		imports := importLines(file.Name, lines)
+		for i := 0; i < len(lines); i++ {
+			if !imports[i] {
+				newRawLines = append(newRawLines, lines[i])
+				continue
+			}
+
+			var line string
+			line, i = importStatement(lines, i)
+			importPath := parseImportPath(line)
+			if !strings.HasPrefix(importPath, "./") && !strings.HasPrefix(importPath, "../") {
+				newRawLines = append(newRawLines, line)
+				continue
+			}
+
+			imported, err := resolveImport(file, importPath, files)
+			if err != nil {
+				newRawLines = append(newRawLines, line)
+				continue
+			}
+
+			absolutePath, err := outputPath(imported)
+			if err != nil {
+				warnf("import '%s' in %s is kept relative, %v", importPath, file.Name, err)
+				newRawLines = append(newRawLines, line)
+				continue
+			}
+
+			newRawLines = append(newRawLines, strings.Replace(line, importPath, absolutePath, 1))
+		}
+		file.RawContent = strings.Join(newRawLines, "\n")
+	}
+}
+
+// matchFileName returns the name of the file of the bundle that name
+// refers to. If there is no file with that exact name, a name without
+// extension matches the .sol file, and a name with an extension matches a
+// file with the same name and another extension, e.g. Foo.vy for Foo.sol.
+func matchFileName(name string, files map[FileName]*SourceCodeFile) (FileName, bool) {
+	if _, ok := files[name]; ok {
+		return name, true
+	}
+
+	if path.Ext(name) == "" {
+		_, ok := files[name+".sol"]
+		return name + ".sol", ok
+	}
+
+	stem := strings.TrimSuffix(name, path.Ext(name))
+	candidates := []FileName{}
+	for n := range files {
+		if strings.TrimSuffix(n, path.Ext(n)) == stem {
+			candidates = append(candidates, n)
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0], true
+	}
+
+	return name, false
+}
+
+// fixImportExtensions points the dependencies whose extension does not
+// match the one of the imported file to that file, warning about them.
+func fixImportExtensions(files map[FileName]*SourceCodeFile) {
+	for _, file := range files {
+		for i, dependency := range file.Dependencies {
+			if _, ok := files[dependency]; ok {
+				continue
+			}
+
+			if name, ok := matchFileName(dependency, files); ok {
+				warnf("file %s imports '%s', which has a different extension than %s, using that file", file.Name, file.Imports[i], name)
+				file.Dependencies[i] = name
+			}
+		}
+	}
+}
+
+// resolveImport returns the file of the bundle imported by importer with
+// importPath. Files in a bundle have unique names, so relative, root
+// anchored and bare name imports are all looked up by the name of the
+// imported file once the path is normalized.
+func resolveImport(importer *SourceCodeFile, importPath string, files map[FileName]*SourceCodeFile) (*SourceCodeFile, error) {
+	if isURLImport(importPath) {
+		return nil, fmt.Errorf("file %s imports URL '%s', which is not part of the bundle", importer.Name, importPath)
+	}
+
+	name, ok := matchFileName(path.Base(path.Clean(importPath)), files)
+	f := files[name]
+	if !ok {
+		return nil, fmt.Errorf("file %s imports '%s', which is not part of the bundle", importer.Name, importPath)
+	}
+
+	return f, nil
+}
+
 func countParentDirsFromImports(file *SourceCodeFile, files map[string]*SourceCodeFile, callstack map[string]bool) *int {
 	if callstack[file.Name] {
 		return nil
@@ -313,15 +1570,29 @@ func countParentDirsFromImports(file *SourceCodeFile, files map[string]*SourceCo
 					parentsCount++
 				}
 			}
-		} else if importFields[0] == "." && strings.HasSuffix(importFields[1], ".sol") {
-			f, ok := files[importFields[1]]
-			if !ok {
-				panic("unexpected file")
+		} else if importFields[0] == "." {
+			f, err := resolveImport(file, imp, files)
+			if err != nil {
+				// an unknown file does not tell anything about the depth
+				continue
+			}
+
+			// the imported file is in a subdirectory with ./sub/Foo.sol,
+			// so it needs that many parents less from this file
+			subdirs := 0
+			if dir := path.Dir(path.Clean(imp)); dir != "." {
+				for _, field := range strings.Split(dir, "/") {
+					if field == ".." {
+						parentsCount++
+					} else {
+						subdirs++
+					}
+				}
 			}
 
 			c := countParentDirsFromImports(f, files, callstack)
 			if c != nil {
-				parentsCount = *c
+				parentsCount = max(parentsCount, parentsCount+*c-subdirs)
 			}
 		}
 
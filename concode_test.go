@@ -0,0 +1,1204 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"golang.org/x/net/html"
+)
+
+// newBundle returns the files of a bundle from their sources, by name, with
+// their imports parsed.
+func newBundle(sources map[FileName]string) map[FileName]*SourceCodeFile {
+	files := map[FileName]*SourceCodeFile{}
+	for name, content := range sources {
+		file := &SourceCodeFile{Name: name, RawContent: content}
+		fillDependenciesAndImports(file)
+		files[name] = file
+	}
+	fixImportExtensions(files)
+
+	return files
+}
+
+// placedPaths returns the output path of every file, by name, or "" for
+// the files without a complete path.
+func placedPaths(files map[FileName]*SourceCodeFile) map[FileName]string {
+	paths := map[FileName]string{}
+	for name, f := range files {
+		relPath, err := outputPath(f)
+		if err != nil {
+			relPath = ""
+		}
+		paths[name] = relPath
+	}
+
+	return paths
+}
+
+// defaultPathOptions are the path options of the fetch command defaults.
+func defaultPathOptions() pathOptions {
+	return pathOptions{Strategy: pathStrategyLongest, MaxDepth: 32}
+}
+
+func TestFillPathsMissingImport(t *testing.T) {
+	files := newBundle(map[FileName]string{
+		"Main.sol": "import \"./Missing.sol\";\nimport \"./lib/Lib.sol\";\n",
+		"Lib.sol":  "",
+	})
+
+	if err := fillPaths(files, defaultPathOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := placedPaths(files)
+	if paths["Main.sol"] != "Main.sol" || paths["Lib.sol"] != "lib/Lib.sol" {
+		t.Errorf("paths = %v", paths)
+	}
+
+	unresolved := unresolvedImports(files)
+	if len(unresolved) != 1 || unresolved[0] != "Main.sol: ./Missing.sol" {
+		t.Errorf("unresolved = %v", unresolved)
+	}
+
+	problems := ambiguities(files)
+	if len(problems) != 1 || !strings.Contains(problems[0], "./Missing.sol") {
+		t.Errorf("ambiguities = %v", problems)
+	}
+}
+
+// baselineBundles are bundles placed the same way by every run of the
+// original fillPaths, whose trees are kept as the reference for the
+// rewrites of the heuristic.
+var baselineBundles = []struct {
+	name    string
+	sources map[FileName]string
+	want    map[FileName]string
+}{
+	{
+		name: "relative imports through sibling directories",
+		sources: map[FileName]string{
+			"Main.sol": "import \"./lib/A.sol\";\nimport \"./B.sol\";\n",
+			"A.sol":    "import \"../utils/C.sol\";\n",
+			"B.sol":    "import \"./utils/C.sol\";\n",
+			"C.sol":    "import \"../lib/D.sol\";\n",
+			"D.sol":    "",
+		},
+		want: map[FileName]string{
+			"Main.sol": "Main.sol",
+			"A.sol":    "lib/A.sol",
+			"B.sol":    "B.sol",
+			"C.sol":    "utils/C.sol",
+			"D.sol":    "lib/D.sol",
+		},
+	},
+	{
+		name: "importer of a parent directory",
+		sources: map[FileName]string{
+			"P.sol": "import \"./x/A.sol\";\n",
+			"Q.sol": "import \"../A.sol\";\n",
+			"A.sol": "",
+		},
+		want: map[FileName]string{
+			"P.sol": "P.sol",
+			"Q.sol": "x/dummy/Q.sol",
+			"A.sol": "x/A.sol",
+		},
+	},
+	{
+		name: "deep relative import",
+		sources: map[FileName]string{
+			"Main.sol": "import \"./a/b/c/D.sol\";\n",
+			"D.sol":    "import \"../../../E.sol\";\n",
+			"E.sol":    "",
+		},
+		want: map[FileName]string{
+			"Main.sol": "Main.sol",
+			"D.sol":    "a/b/c/D.sol",
+			"E.sol":    "E.sol",
+		},
+	},
+	{
+		name: "facets sharing a library",
+		sources: map[FileName]string{
+			"Main.sol":       "import \"./facets/A.sol\";\nimport \"./facets/B.sol\";\n",
+			"A.sol":          "import \"../libraries/LibDiamond.sol\";\n",
+			"B.sol":          "import \"../libraries/LibDiamond.sol\";\n",
+			"LibDiamond.sol": "import \"../interfaces/IDiamond.sol\";\n",
+			"IDiamond.sol":   "",
+		},
+		want: map[FileName]string{
+			"Main.sol":       "Main.sol",
+			"A.sol":          "facets/A.sol",
+			"B.sol":          "facets/B.sol",
+			"LibDiamond.sol": "libraries/LibDiamond.sol",
+			"IDiamond.sol":   "interfaces/IDiamond.sol",
+		},
+	},
+	{
+		name: "package imports",
+		sources: map[FileName]string{
+			"Token.sol":          "import \"@openzeppelin/contracts/token/ERC20/ERC20.sol\";\n",
+			"ERC20.sol":          "import \"./IERC20.sol\";\nimport \"./extensions/IERC20Metadata.sol\";\nimport \"../../utils/Context.sol\";\n",
+			"IERC20Metadata.sol": "import \"../IERC20.sol\";\n",
+			"IERC20.sol":         "",
+			"Context.sol":        "",
+		},
+		want: map[FileName]string{
+			"Token.sol":          "Token.sol",
+			"ERC20.sol":          "@openzeppelin/contracts/token/ERC20/ERC20.sol",
+			"IERC20Metadata.sol": "@openzeppelin/contracts/token/ERC20/extensions/IERC20Metadata.sol",
+			"IERC20.sol":         "@openzeppelin/contracts/token/ERC20/IERC20.sol",
+			"Context.sol":        "@openzeppelin/contracts/utils/Context.sol",
+		},
+	},
+	{
+		name: "imported file importing its importer's sibling",
+		sources: map[FileName]string{
+			"Main.sol":  "import \"./Lib.sol\";\nimport \"./interfaces/IMain.sol\";\n",
+			"Lib.sol":   "",
+			"IMain.sol": "import \"../Lib.sol\";\n",
+		},
+		want: map[FileName]string{
+			"Main.sol":  "Main.sol",
+			"Lib.sol":   "Lib.sol",
+			"IMain.sol": "interfaces/IMain.sol",
+		},
+	},
+}
+
+func TestFillPathsBaseline(t *testing.T) {
+	for _, tt := range baselineBundles {
+		t.Run(tt.name, func(t *testing.T) {
+			// the original heuristic depended on the order of the maps, so
+			// a single run could pass by chance
+			for i := 0; i < 50; i++ {
+				files := newBundle(tt.sources)
+				if err := fillPaths(files, defaultPathOptions()); err != nil {
+					t.Fatal(err)
+				}
+				if got := placedPaths(files); !maps.Equal(got, tt.want) {
+					t.Fatalf("run %d: paths = %v, want %v", i, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// syntheticBundle returns a bundle of n files with a regular import graph:
+// a chain of files in nested directories, a diamond where every file
+// imports the next two through parent directories, or a fan where every
+// file is imported by two files.
+func syntheticBundle(n int, shape string) map[FileName]string {
+	sources := map[FileName]string{}
+	for i := 0; i < n; i++ {
+		content := ""
+		switch shape {
+		case "chain":
+			if i+1 < n {
+				content = fmt.Sprintf("import \"./d%d/F%d.sol\";\n", i+1, i+1)
+			}
+		case "diamond":
+			for _, j := range []int{i + 1, i + 2} {
+				if j < n {
+					content += fmt.Sprintf("import \"../d%d/F%d.sol\";\n", j%3, j)
+				}
+			}
+		case "fan":
+			if i > 0 {
+				content = fmt.Sprintf("import \"./F%d.sol\";\nimport \"./F%d.sol\";\n", (i-1)/2, i/2)
+			}
+		}
+		sources[fmt.Sprintf("F%d.sol", i)] = content
+	}
+
+	return sources
+}
+
+func BenchmarkFillPaths(b *testing.B) {
+	for _, shape := range []string{"chain", "diamond", "fan"} {
+		for _, n := range []int{50, 500} {
+			sources := syntheticBundle(n, shape)
+			b.Run(fmt.Sprintf("%s-%d", shape, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					files := newBundle(sources)
+					if err := fillPaths(files, defaultPathOptions()); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestFillPathsDeterministic(t *testing.T) {
+	bundles := map[string]map[FileName]string{
+		"shared import": {
+			"A.sol": "import \"./lib/L.sol\";\n",
+			"B.sol": "import \"./lib/L.sol\";\n",
+			"L.sol": "import \"./M.sol\";\n",
+			"M.sol": "",
+		},
+		"conflicting importers": {
+			"A.sol": "import \"./x/C.sol\";\n",
+			"B.sol": "import \"./y/C.sol\";\n",
+			"C.sol": "",
+		},
+		"two roots": {
+			"R1.sol": "import \"./a/X.sol\";\n",
+			"R2.sol": "import \"./b/Y.sol\";\n",
+			"X.sol":  "import \"../b/Y.sol\";\n",
+			"Y.sol":  "import \"./Z.sol\";\n",
+			"Z.sol":  "",
+		},
+		"up then down": {
+			"Vault.sol":  "import \"../interfaces/IVault.sol\";\nimport \"../libraries/Math.sol\";\n",
+			"IVault.sol": "",
+			"Math.sol":   "import \"../interfaces/IVault.sol\";\n",
+		},
+		"placeholder tie": {
+			"A.sol": "import \"./c/e/F.sol\";\n",
+			"B.sol": "import \"../F.sol\";\nimport \"./G.sol\";\n",
+			"F.sol": "",
+			"G.sol": "",
+		},
+	}
+
+	for name, sources := range bundles {
+		t.Run(name, func(t *testing.T) {
+			var first map[FileName]string
+			for i := 0; i < 100; i++ {
+				files := newBundle(sources)
+				if err := fillPaths(files, defaultPathOptions()); err != nil {
+					t.Fatal(err)
+				}
+
+				got := placedPaths(files)
+				if first == nil {
+					first = got
+				} else if !maps.Equal(got, first) {
+					t.Fatalf("run %d: paths = %v, first run %v", i, got, first)
+				}
+			}
+		})
+	}
+}
+
+func TestLongerPath(t *testing.T) {
+	tests := []struct {
+		candidate, current []string
+		want               bool
+	}{
+		{[]string{rootDirName, "a", "b"}, []string{rootDirName, "a"}, true},
+		{[]string{rootDirName}, []string{rootDirName, "a"}, false},
+		// with the same length, real directories beat placeholders
+		{[]string{rootDirName, "c", "e"}, []string{rootDirName, "c", placeholderDirName}, true},
+		{[]string{rootDirName, placeholderDirName}, []string{rootDirName, "a"}, false},
+		// then complete paths beat incomplete ones
+		{[]string{rootDirName, "a"}, []string{"a", "b"}, true},
+		// and then the lexicographically smaller path wins
+		{[]string{rootDirName, "x"}, []string{rootDirName, "y"}, true},
+		{[]string{rootDirName, "y"}, []string{rootDirName, "x"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := longerPath(tt.candidate, tt.current); got != tt.want {
+			t.Errorf("longerPath(%v, %v) = %t, want %t", tt.candidate, tt.current, got, tt.want)
+		}
+	}
+}
+
+func TestFillPathsRootDependentImportsParent(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources map[FileName]string
+		want    map[FileName]string
+	}{
+		{
+			name: "top level file importing a parent",
+			sources: map[FileName]string{
+				"Top.sol": "import \"../Foo.sol\";\n",
+				"Foo.sol": "",
+			},
+			want: map[FileName]string{
+				"Top.sol": "dummy/Top.sol",
+				"Foo.sol": "Foo.sol",
+			},
+		},
+		{
+			name: "parent import resolved through a subdirectory",
+			sources: map[FileName]string{
+				"P.sol": "import \"./x/A.sol\";\n",
+				"Q.sol": "import \"../A.sol\";\n",
+				"A.sol": "",
+			},
+			want: map[FileName]string{
+				"P.sol": "P.sol",
+				"A.sol": "x/A.sol",
+				"Q.sol": "x/dummy/Q.sol",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				files := newBundle(tt.sources)
+				if err := fillPaths(files, defaultPathOptions()); err != nil {
+					t.Fatal(err)
+				}
+
+				if got := placedPaths(files); !maps.Equal(got, tt.want) {
+					t.Fatalf("run %d: paths = %v, want %v", i, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFillDependenciesAndImports(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		imports      []string
+		dependencies []string
+	}{
+		{
+			name:         "single line",
+			content:      "import \"./A.sol\";\nimport './lib/B.sol';\n",
+			imports:      []string{"./A.sol", "./lib/B.sol"},
+			dependencies: []string{"A.sol", "B.sol"},
+		},
+		{
+			name:         "path with spaces",
+			content:      "import \"./my lib/Foo.sol\";\n",
+			imports:      []string{"./my lib/Foo.sol"},
+			dependencies: []string{"Foo.sol"},
+		},
+		{
+			name:         "multi-line named import",
+			content:      "import {\n    B\n} from \"./B.sol\";\ncontract A {}\n",
+			imports:      []string{"./B.sol"},
+			dependencies: []string{"B.sol"},
+		},
+		{
+			name:         "multi-line statement followed by another import",
+			content:      "import {\n    B,\n    C\n}\n    from \"./B.sol\";\nimport \"./D.sol\";\n",
+			imports:      []string{"./B.sol", "./D.sol"},
+			dependencies: []string{"B.sol", "D.sol"},
+		},
+		{
+			name:         "import without semicolon",
+			content:      "import \"./A.sol\"\nimport \"./B.sol\";\n",
+			imports:      []string{"./A.sol", "./B.sol"},
+			dependencies: []string{"A.sol", "B.sol"},
+		},
+		{
+			name:         "imports in comments and assembly",
+			content:      "/*\nimport \"./A.sol\";\n*/\nimport \"./B.sol\";\nfunction f() {\n    assembly {\n        import := 1\n    }\n}\n",
+			imports:      []string{"./B.sol"},
+			dependencies: []string{"B.sol"},
+		},
+		{
+			name:         "duplicated import",
+			content:      "import \"./A.sol\";\nimport \"./B.sol\";\nimport \"./A.sol\";\n",
+			imports:      []string{"./A.sol", "./B.sol"},
+			dependencies: []string{"A.sol", "B.sol"},
+		},
+		{
+			name:         "same import written differently",
+			content:      "import {X} from \"./lib/A.sol\";\nimport {Y} from \"./lib/../lib/A.sol\";\n",
+			imports:      []string{"./lib/A.sol"},
+			dependencies: []string{"A.sol"},
+		},
+		{
+			name:         "wildcard namespace import",
+			content:      "import * as Utils from \"./Utils.sol\";\n",
+			imports:      []string{"./Utils.sol"},
+			dependencies: []string{"Utils.sol"},
+		},
+		{
+			name:         "multi-line wildcard namespace import",
+			content:      "import *\n    as Utils\n    from \"./lib/Utils.sol\";\n",
+			imports:      []string{"./lib/Utils.sol"},
+			dependencies: []string{"Utils.sol"},
+		},
+		{
+			name:         "renamed symbol",
+			content:      "import {A as B} from \"./A.sol\";\n",
+			imports:      []string{"./A.sol"},
+			dependencies: []string{"A.sol"},
+		},
+		{
+			name:         "multi-line renamed symbol",
+			content:      "import {\n    A as B\n} from \"./A.sol\";\n",
+			imports:      []string{"./A.sol"},
+			dependencies: []string{"A.sol"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &SourceCodeFile{Name: "Main.sol", RawContent: tt.content}
+			fillDependenciesAndImports(file)
+
+			if fmt.Sprint(file.Imports) != fmt.Sprint(tt.imports) {
+				t.Errorf("Imports = %q, want %q", file.Imports, tt.imports)
+			}
+			if fmt.Sprint(file.Dependencies) != fmt.Sprint(tt.dependencies) {
+				t.Errorf("Dependencies = %q, want %q", file.Dependencies, tt.dependencies)
+			}
+		})
+	}
+}
+
+func TestAddBasePathToMultiLineImports(t *testing.T) {
+	files := map[FileName]*SourceCodeFile{
+		"A.sol": {
+			Name:       "A.sol",
+			RawContent: "import {\n    B\n} from \"contracts/B.sol\";\nimport \"./C.sol\";\ncontract A {}\n",
+		},
+	}
+
+	addBasePathToImports(files, "src", nil)
+
+	want := "import {\n    B\n} from \"src/contracts/B.sol\";\nimport \"./C.sol\";\ncontract A {}\n"
+	if got := files["A.sol"].RawContent; got != want {
+		t.Errorf("RawContent = %q, want %q", got, want)
+	}
+}
+
+func TestParseImportPath(t *testing.T) {
+	tests := []struct {
+		statement string
+		want      string
+	}{
+		{`import "./A.sol";`, "./A.sol"},
+		{`import * as Utils from "./Utils.sol";`, "./Utils.sol"},
+		{"import *\n    as Utils\n    from './Utils.sol';", "./Utils.sol"},
+		{`import {A as B, C} from "./A.sol";`, "./A.sol"},
+		{`import "./A.sol" as A;`, "./A.sol"},
+		// without quotes, the alias is not taken as the path
+		{`import * as Utils from ./Utils.sol;`, "./Utils.sol"},
+		{"import {\n    A as B\n} from ./A.sol;", "./A.sol"},
+		{`import ./A.sol as A;`, "./A.sol"},
+	}
+
+	for _, tt := range tests {
+		if got := parseImportPath(tt.statement); got != tt.want {
+			t.Errorf("parseImportPath(%q) = %q, want %q", tt.statement, got, tt.want)
+		}
+	}
+}
+
+func TestAliasedImportsLineUp(t *testing.T) {
+	sources := map[FileName]string{
+		"Main.sol": "import \"./lib/A.sol\" as A;\n" +
+			"import {\n    B as Bee,\n    C as Sea\n} from \"./lib/B.sol\";\n" +
+			"import * as Utils from \"../utils/Utils.sol\";\n" +
+			"import {\n    A as A2\n} from \"./lib/A.sol\";\n" +
+			"import \"./Main.sol\" as Self;\n" +
+			"import {D as Dee} from \"./lib/D.sol\";\n",
+		"A.sol":     "",
+		"B.sol":     "",
+		"D.sol":     "",
+		"Utils.sol": "",
+	}
+	files := newBundle(sources)
+
+	main := files["Main.sol"]
+	wantImports := []string{"./lib/A.sol", "./lib/B.sol", "../utils/Utils.sol", "./lib/D.sol"}
+	if fmt.Sprint(main.Imports) != fmt.Sprint(wantImports) {
+		t.Fatalf("Imports = %q, want %q", main.Imports, wantImports)
+	}
+	if len(main.Dependencies) != len(main.Imports) {
+		t.Fatalf("Dependencies = %q, Imports = %q", main.Dependencies, main.Imports)
+	}
+	for i, imp := range main.Imports {
+		if dependency := imp[strings.LastIndex(imp, "/")+1:]; main.Dependencies[i] != dependency {
+			t.Errorf("Dependencies[%d] = %q, want %q for import %q", i, main.Dependencies[i], dependency, imp)
+		}
+	}
+
+	if err := fillPaths(files, defaultPathOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[FileName]string{
+		"Main.sol":  "dummy/Main.sol",
+		"A.sol":     "dummy/lib/A.sol",
+		"B.sol":     "dummy/lib/B.sol",
+		"D.sol":     "dummy/lib/D.sol",
+		"Utils.sol": "utils/Utils.sol",
+	}
+	if got := placedPaths(files); !maps.Equal(got, want) {
+		t.Errorf("paths = %v, want %v", got, want)
+	}
+}
+
+func TestReadSourceArea(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{
+			name: "plain source",
+			page: `<pre class="js-sourcecopyarea editor" id="editor">contract A {}</pre>`,
+			want: "contract A {}",
+		},
+		{
+			name: "line breaks",
+			page: `<pre class="js-sourcecopyarea">contract A {<br>}<br/></pre>`,
+			want: "contract A {\n}\n",
+		},
+		{
+			name: "gutter with line breaks",
+			page: `<pre class="js-sourcecopyarea"><div class="gutter">1<br>2<br></div>contract A {}</pre>`,
+			want: "contract A {}",
+		},
+		{
+			name: "gutter with other void elements",
+			page: `<pre class="js-sourcecopyarea"><div class="gutter">1<hr>2<wbr><img src="x.png"><input type="checkbox"></div>contract A {}</pre>`,
+			want: "contract A {}",
+		},
+		{
+			name: "numbered lines",
+			page: `<pre class="js-sourcecopyarea editor" id="editor1"><ol class="linenums">` +
+				`<li class="L0"><span class="lineno">1</span><span class="pln">pragma solidity ^0.8.0;</span></li>` +
+				`<li class="L1"><span class="lineno">2</span><span class="pln">contract A {}</span></li>` +
+				`</ol></pre>`,
+			want: "pragma solidity ^0.8.0;\ncontract A {}\n",
+		},
+		{
+			name: "void gutter element",
+			page: `<pre class="js-sourcecopyarea"><img class="gutter" src="x.png">contract A {}</pre>`,
+			want: "contract A {}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenizer := html.NewTokenizer(strings.NewReader(tt.page))
+			tokenizer.Next()
+
+			got, err := readSourceArea(tokenizer, "pre")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("readSourceArea() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddBasePathToImports(t *testing.T) {
+	tests := []struct {
+		name     string
+		basePath string
+		line     string
+		want     string
+	}{
+		{"root import", "lib", `import "forge-std/Test.sol";`, `import "lib/forge-std/Test.sol";`},
+		{"already prefixed", "lib", `import "lib/forge-std/Test.sol";`, `import "lib/forge-std/Test.sol";`},
+		{"prefixed with a trailing slash", "lib/", `import "lib/forge-std/Test.sol";`, `import "lib/forge-std/Test.sol";`},
+		{"prefix of a directory name", "lib", `import "library/Foo.sol";`, `import "lib/library/Foo.sol";`},
+		{"relative import", "lib", `import "./Foo.sol";`, `import "./Foo.sol";`},
+		{"URL import", "lib", `import "https://example.com/Foo.sol";`, `import "https://example.com/Foo.sol";`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[FileName]*SourceCodeFile{"A.sol": {Name: "A.sol", RawContent: tt.line}}
+			addBasePathToImports(files, tt.basePath, nil)
+
+			if got := files["A.sol"].RawContent; got != tt.want {
+				t.Errorf("RawContent = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFillPathsNoImports(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources map[FileName]string
+		want    map[FileName]string
+	}{
+		{
+			name:    "single file",
+			sources: map[FileName]string{"Counter.sol": "contract Counter {}\n"},
+			want:    map[FileName]string{"Counter.sol": "Counter.sol"},
+		},
+		{
+			name: "several files",
+			sources: map[FileName]string{
+				"A.sol": "contract A {}\n",
+				"B.sol": "contract B {}\n",
+			},
+			want: map[FileName]string{"A.sol": "A.sol", "B.sol": "B.sol"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := newBundle(tt.sources)
+			if err := fillPaths(files, defaultPathOptions()); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := placedPaths(files); !maps.Equal(got, tt.want) {
+				t.Errorf("paths = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFillPathsStrategies(t *testing.T) {
+	// two importers at the root place L.sol in lib, and a third one
+	// places it one directory deeper
+	sources := map[FileName]string{
+		"A.sol": "import \"./lib/L.sol\";\n",
+		"B.sol": "import \"./lib/L.sol\";\n",
+		"C.sol": "import \"./vendor/lib/L.sol\";\n",
+		"L.sol": "",
+	}
+
+	tests := []struct {
+		strategy string
+		want     string
+	}{
+		{pathStrategyLongest, "vendor/lib/L.sol"},
+		{pathStrategyFrequent, "lib/L.sol"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				files := newBundle(sources)
+				opts := defaultPathOptions()
+				opts.Strategy = tt.strategy
+				if err := fillPaths(files, opts); err != nil {
+					t.Fatal(err)
+				}
+
+				if got := placedPaths(files)["L.sol"]; got != tt.want {
+					t.Fatalf("run %d: L.sol = %s, want %s", i, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFillPathsAboveRoot(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources map[FileName]string
+		want    map[FileName]string
+	}{
+		{
+			name: "two levels above the importer",
+			sources: map[FileName]string{
+				"Root.sol": "import \"./a/b/Main.sol\";\n",
+				"Main.sol": "import \"../../Top.sol\";\n",
+				"Top.sol":  "",
+			},
+			want: map[FileName]string{
+				"Root.sol": "Root.sol",
+				"Main.sol": "a/b/Main.sol",
+				"Top.sol":  "Top.sol",
+			},
+		},
+		{
+			name: "two levels above the root",
+			sources: map[FileName]string{
+				"Root.sol": "import \"./Main.sol\";\n",
+				"Main.sol": "import \"../../Top.sol\";\n",
+				"Top.sol":  "",
+			},
+			want: map[FileName]string{
+				"Root.sol": "dummy/dummy/Root.sol",
+				"Main.sol": "dummy/dummy/Main.sol",
+				"Top.sol":  "Top.sol",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := newBundle(tt.sources)
+			if err := fillPaths(files, defaultPathOptions()); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := placedPaths(files); !maps.Equal(got, tt.want) {
+				t.Errorf("paths = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelfImport(t *testing.T) {
+	files := newBundle(map[FileName]string{
+		"Main.sol": "import \"./Main.sol\";\nimport \"./lib/Lib.sol\";\nimport \"./Self.sol\";\n",
+		"Lib.sol":  "import \"../lib/Lib.sol\";\n",
+		"Self.sol": "import \"./Self\";\n",
+	})
+
+	for name, f := range files {
+		if len(f.Imports) != len(f.Dependencies) || slices.Contains(f.Dependencies, name) {
+			t.Errorf("%s: Imports = %q, Dependencies = %q", name, f.Imports, f.Dependencies)
+		}
+	}
+
+	if err := fillPaths(files, defaultPathOptions()); err != nil {
+		t.Fatal(err)
+	}
+	want := map[FileName]string{"Main.sol": "Main.sol", "Lib.sol": "lib/Lib.sol", "Self.sol": "Self.sol"}
+	if got := placedPaths(files); !maps.Equal(got, want) {
+		t.Errorf("paths = %v, want %v", got, want)
+	}
+
+	graph := dependencyGraph(files)
+	if strings.Contains(graph, `"Main.sol" -> "Main.sol"`) || strings.Contains(graph, `"Lib.sol" -> "Lib.sol"`) || strings.Contains(graph, `"Self.sol" -> "Self.sol"`) {
+		t.Errorf("the graph has a self loop:\n%s", graph)
+	}
+}
+
+func TestFillPathsDuplicatedParentImport(t *testing.T) {
+	files := newBundle(map[FileName]string{
+		"Main.sol": "import {A} from \"../A.sol\";\nimport {B} from \"../A.sol\";\n",
+		"A.sol":    "",
+	})
+	if err := fillPaths(files, defaultPathOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the parent import is only counted once
+	want := map[FileName]string{"Main.sol": "dummy/Main.sol", "A.sol": "A.sol"}
+	if got := placedPaths(files); !maps.Equal(got, want) {
+		t.Errorf("paths = %v, want %v", got, want)
+	}
+}
+
+func TestGetFilesRedirect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/address/0x5fbdb2315678afecb367f032d93f642f64180aa3":
+			http.Redirect(w, r, "/captcha?return=/address/0x5fbdb2315678afecb367f032d93f642f64180aa3", http.StatusFound)
+		case "/address/0xe7f1725e7734ce288f8367e1bb143e90bb3f0512":
+			http.Redirect(w, r, r.URL.Path+"/#code", http.StatusMovedPermanently)
+		case "/address/0xe7f1725e7734ce288f8367e1bb143e90bb3f0512/":
+			_, _ = w.Write([]byte(`<span class="text-muted">File 1 of 1 : A.sol</span><pre class="js-sourcecopyarea">contract A {}</pre>`))
+		default:
+			_, _ = w.Write([]byte(`<html><body><form action="/captcha">Verify you are human</form></body></html>`))
+		}
+	}))
+	defer srv.Close()
+
+	f := newFetcher(fetcherOptions{})
+
+	_, err := getFiles(f, srv.URL+"/address/0x5fbdb2315678afecb367f032d93f642f64180aa3", nil)
+	if err == nil || !strings.Contains(err.Error(), "captcha") || !strings.Contains(err.Error(), "/captcha?return=") {
+		t.Errorf("err = %v, want the redirect to the captcha page", err)
+	}
+
+	// a trailing slash or a fragment is the same page
+	result, err := getFiles(f, srv.URL+"/address/0xe7f1725e7734ce288f8367e1bb143e90bb3f0512", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Files) != 1 {
+		t.Errorf("%d files, want 1", len(result.Files))
+	}
+}
+
+func TestRedirectedElsewhere(t *testing.T) {
+	tests := []struct {
+		url, finalURL string
+		want          bool
+	}{
+		{"https://etherscan.io/address/0xabc", "https://etherscan.io/address/0xabc", false},
+		{"https://etherscan.io/address/0xabc", "https://etherscan.io/address/0xABC/#code", false},
+		{"http://etherscan.io/address/0xabc", "https://www.etherscan.io/address/0xabc", false},
+		{"https://etherscan.io/address/0xabc", "https://etherscan.io/captcha", true},
+		{"https://etherscan.io/address/0xabc", "https://etherscan.io/login?return=/address/0xabc", true},
+	}
+
+	for _, tt := range tests {
+		if got := redirectedElsewhere(tt.url, tt.finalURL); got != tt.want {
+			t.Errorf("redirectedElsewhere(%q, %q) = %t, want %t", tt.url, tt.finalURL, got, tt.want)
+		}
+	}
+}
+
+func TestIsImportLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{`import "./A.sol";`, true},
+		{"import\t\"./A.sol\";", true},
+		{`  import {A} from "./A.sol";`, true},
+		{`import{A} from "./A.sol";`, true},
+		{`import*as A from "./A.sol";`, true},
+		{`import`, false},
+		{`importantThing();`, false},
+		{`import_helper();`, false},
+		{`import$ = 1;`, false},
+		{`import2 = 1;`, false},
+		{`// import "./A.sol";`, false},
+		{`reimport("./A.sol");`, false},
+	}
+
+	for _, tt := range tests {
+		if got := isImportLine(tt.line); got != tt.want {
+			t.Errorf("isImportLine(%q) = %t, want %t", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestMatchFileName(t *testing.T) {
+	files := map[FileName]*SourceCodeFile{
+		"Foo.sol":   {Name: "Foo.sol"},
+		"Token.vy":  {Name: "Token.vy"},
+		"Math.sol":  {Name: "Math.sol"},
+		"Math.yul":  {Name: "Math.yul"},
+		"Other.sol": {Name: "Other.sol"},
+	}
+
+	tests := []struct {
+		name  string
+		want  FileName
+		found bool
+	}{
+		{"Foo.sol", "Foo.sol", true},
+		{"Foo", "Foo.sol", true},
+		{"Token.sol", "Token.vy", true},
+		// with several files of the same stem the extension decides
+		{"Math.sol", "Math.sol", true},
+		{"Math.vy", "Math.vy", false},
+		{"Missing", "Missing.sol", false},
+		{"Missing.sol", "Missing.sol", false},
+	}
+
+	for _, tt := range tests {
+		got, found := matchFileName(tt.name, files)
+		if got != tt.want || found != tt.found {
+			t.Errorf("matchFileName(%q) = %q, %t, want %q, %t", tt.name, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestFillPathsExtensionlessImport(t *testing.T) {
+	files := newBundle(map[FileName]string{
+		"Main.sol":  "import \"./lib/Foo\";\nimport \"./lib/Token.sol\";\n",
+		"Foo.sol":   "",
+		"Token.vy":  "",
+		"Other.sol": "",
+	})
+
+	if deps := files["Main.sol"].Dependencies; fmt.Sprint(deps) != "[Foo.sol Token.vy]" {
+		t.Errorf("Dependencies = %q, want [Foo.sol Token.vy]", deps)
+	}
+
+	if err := fillPaths(files, defaultPathOptions()); err != nil {
+		t.Fatal(err)
+	}
+	got := placedPaths(files)
+	if got["Foo.sol"] != "lib/Foo.sol" || got["Token.vy"] != "lib/Token.vy" {
+		t.Errorf("paths = %v", got)
+	}
+}
+
+func TestFillPathsBareNameImport(t *testing.T) {
+	sources := map[FileName]string{
+		"Root.sol": "import \"./lib/Main.sol\";\nimport \"Bar.sol\";\n",
+		"Main.sol": "import \"Foo.sol\";\n",
+		"Foo.sol":  "",
+		"Bar.sol":  "",
+	}
+
+	// a bare file name is a sibling of the importer with every import
+	// style
+	for _, importStyle := range []string{importStyleRoot, importStyleRelative} {
+		t.Run(importStyle, func(t *testing.T) {
+			files := newBundle(sources)
+			opts := defaultPathOptions()
+			opts.ImportStyle = importStyle
+			if err := fillPaths(files, opts); err != nil {
+				t.Fatal(err)
+			}
+
+			want := map[FileName]string{
+				"Root.sol": "Root.sol",
+				"Main.sol": "lib/Main.sol",
+				"Foo.sol":  "lib/Foo.sol",
+				"Bar.sol":  "Bar.sol",
+			}
+			if got := placedPaths(files); !maps.Equal(got, want) {
+				t.Errorf("paths = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestImportLines(t *testing.T) {
+	tests := []struct {
+		name    FileName
+		content string
+		want    []bool
+	}{
+		{
+			name:    "A.sol",
+			content: "import \"./B.sol\";\ncontract A {}",
+			want:    []bool{true, false},
+		},
+		{
+			name:    "A.sol",
+			content: "contract A {\n    function f() public {\n        assembly {\n            // import the pointer\n            import := mload(0x40)\n            {\n                import := 1\n            }\n        }\n    }\n}\nimport \"./B.sol\";",
+			want:    []bool{false, false, false, false, false, false, false, false, false, false, false, true},
+		},
+		{
+			name:    "A.sol",
+			content: "/* import \"./B.sol\";\nimport \"./C.sol\"; */\nimport \"./D.sol\"; // import \"./E.sol\";",
+			want:    []bool{false, false, true},
+		},
+		{
+			name:    "A.sol",
+			content: "string constant s = \"assembly {\";\nimport \"./B.sol\";",
+			want:    []bool{false, true},
+		},
+		{
+			name:    "Object.yul",
+			content: "object \"A\" {\nimport \"./B.sol\";\n}",
+			want:    []bool{false, false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		lines := strings.Split(tt.content, "\n")
+		if got := importLines(tt.name, lines); !slices.Equal(got, tt.want) {
+			t.Errorf("importLines(%s, %q) = %v, want %v", tt.name, tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestCleanImportPath(t *testing.T) {
+	tests := []struct {
+		importPath string
+		want       string
+	}{
+		{"../utils/../token/Foo.sol", "../token/Foo.sol"},
+		{"./a/./b/../Foo.sol", "./a/Foo.sol"},
+		{"./a/../../Foo.sol", "../Foo.sol"},
+		{"./Foo.sol", "./Foo.sol"},
+		{"contracts//Foo.sol", "contracts/Foo.sol"},
+		{"@openzeppelin/contracts/../contracts/token/ERC20.sol", "@openzeppelin/contracts/token/ERC20.sol"},
+		{"https://example.com/a/../Foo.sol", "https://example.com/a/../Foo.sol"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := cleanImportPath(tt.importPath); got != tt.want {
+			t.Errorf("cleanImportPath(%q) = %q, want %q", tt.importPath, got, tt.want)
+		}
+	}
+}
+
+func TestFillPathsNonNormalizedImport(t *testing.T) {
+	files := newBundle(map[FileName]string{
+		"Root.sol": "import \"./contracts/utils/Main.sol\";\n",
+		"Main.sol": "import \"../utils/../token/Foo.sol\";\n",
+		"Foo.sol":  "",
+	})
+	if err := fillPaths(files, defaultPathOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[FileName]string{
+		"Root.sol": "Root.sol",
+		"Main.sol": "contracts/utils/Main.sol",
+		"Foo.sol":  "contracts/token/Foo.sol",
+	}
+	if got := placedPaths(files); !maps.Equal(got, want) {
+		t.Errorf("paths = %v, want %v", got, want)
+	}
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"0x5fbdb2315678afecb367f032d93f642f64180aa3", "0x5fbdb2315678afecb367f032d93f642f64180aa3", false},
+		{" 0x5FbDB2315678afecb367f032d93F642f64180aa3\n", "0x5fbdb2315678afecb367f032d93f642f64180aa3", false},
+		{"\t0X5FBDB2315678AFECB367F032D93F642F64180AA3 ", "0x5fbdb2315678afecb367f032d93f642f64180aa3", false},
+		{"0x5fbdb2315678afecb367f032d93f642f64180aa", "", true},
+		{"0x5fbdb2315678afecb367f032d93f642f64180aag", "", true},
+		{"5fbdb2315678afecb367f032d93f642f64180aa3", "", true},
+		{"  ", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeAddress(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("normalizeAddress(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseFilesReadError(t *testing.T) {
+	page, err := os.ReadFile(filepath.Join("testdata", "pipeline", "multi-file", "page.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cut := bytes.Index(page, []byte("File 4 of 5"))
+
+	resetErr := errors.New("connection reset by peer")
+	r := io.MultiReader(bytes.NewReader(page[:cut]), iotest.ErrReader(resetErr))
+	result, err := parseFiles(r, nil)
+
+	var pErr *partialParseError
+	if !errors.As(err, &pErr) || !errors.Is(err, resetErr) {
+		t.Fatalf("err = %v, want a partial parse error wrapping the read error", err)
+	}
+	if pErr.FileCount != 3 || len(result.Files) != 3 {
+		t.Errorf("FileCount = %d, %d files, want 3", pErr.FileCount, len(result.Files))
+	}
+	if result.ContractName != "Token" {
+		t.Errorf("ContractName = %q, want Token", result.ContractName)
+	}
+}
+
+func TestReadSourceAreaUnclosed(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{
+			name: "page ends",
+			page: `<pre class="js-sourcecopyarea">contract A {}</div></body></html>`,
+			want: "the page ends before the <pre> source element is closed",
+		},
+		{
+			name: "too many tokens",
+			page: `<pre class="js-sourcecopyarea">` + strings.Repeat("<b>", maxSourceAreaTokens),
+			want: "the <pre> source element is not closed after",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenizer := html.NewTokenizer(strings.NewReader(tt.page))
+			tokenizer.Next()
+
+			_, err := readSourceArea(tokenizer, "pre")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountParentDirsFromImports(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources map[FileName]string
+		want    int
+	}{
+		{
+			name:    "no imports",
+			sources: map[FileName]string{"Main.sol": ""},
+			want:    0,
+		},
+		{
+			name: "parent import",
+			sources: map[FileName]string{
+				"Main.sol": "import \"../../A.sol\";\n",
+				"A.sol":    "",
+			},
+			want: 2,
+		},
+		{
+			name: "sibling importing a parent",
+			sources: map[FileName]string{
+				"Main.sol": "import \"./Foo.sol\";\n",
+				"Foo.sol":  "import \"../A.sol\";\n",
+				"A.sol":    "",
+			},
+			want: 1,
+		},
+		{
+			name: "subdirectory importing a parent",
+			sources: map[FileName]string{
+				"Main.sol": "import \"./sub/Foo.sol\";\n",
+				"Foo.sol":  "import \"../../A.sol\";\n",
+				"A.sol":    "",
+			},
+			want: 1,
+		},
+		{
+			name: "subdirectory importing a sibling of the importer",
+			sources: map[FileName]string{
+				"Main.sol": "import \"./sub/Foo.sol\";\n",
+				"Foo.sol":  "import \"../A.sol\";\n",
+				"A.sol":    "",
+			},
+			want: 0,
+		},
+		{
+			name: "import cycle",
+			sources: map[FileName]string{
+				"Main.sol": "import \"./Foo.sol\";\n",
+				"Foo.sol":  "import \"./Main.sol\";\nimport \"../A.sol\";\n",
+				"A.sol":    "",
+			},
+			want: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := newBundle(tt.sources)
+			got := countParentDirsFromImports(files["Main.sol"], files, map[string]bool{})
+			if got == nil || *got != tt.want {
+				t.Errorf("countParentDirsFromImports() = %v, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFillPathsSubdirectoryImportingParent(t *testing.T) {
+	files := newBundle(map[FileName]string{
+		"Main.sol": "import \"./sub/Foo.sol\";\n",
+		"Foo.sol":  "import \"../../A.sol\";\n",
+		"A.sol":    "",
+	})
+	if err := fillPaths(files, defaultPathOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[FileName]string{
+		"Main.sol": "dummy/Main.sol",
+		"Foo.sol":  "dummy/sub/Foo.sol",
+		"A.sol":    "A.sol",
+	}
+	if got := placedPaths(files); !maps.Equal(got, want) {
+		t.Errorf("paths = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+)
+
+// configFilePath returns the path of the config file. It can be overridden
+// with the CONCODE_CONFIG environment variable.
+func configFilePath() (string, error) {
+	if p := os.Getenv("CONCODE_CONFIG"); p != "" {
+		return p, nil
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(configDir, "concode", "config.json"), nil
+}
+
+// loadConfigFile sets the flags found in the config file. The file is a JSON
+// object whose keys are flag names, and list values set repeatable flags
+// once per element. It must be called before flag.Parse so that the command
+// line flags override the values from the file. Options that the command
+// does not have are ignored, since the file is shared by all commands. A
+// missing file is not an error.
+func loadConfigFile(flags *flag.FlagSet, configPath string) error {
+	raw, err := os.ReadFile(configPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read config file %s: %v", configPath, err)
+	}
+
+	// numbers are kept as written, so that 1000000 is not set as "1e+06"
+	values := map[string]any{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return fmt.Errorf("could not parse config file %s: %v", configPath, err)
+	}
+
+	for name, value := range values {
+		if flags.Lookup(name) == nil {
+			continue
+		}
+
+		list, ok := value.([]any)
+		if !ok {
+			list = []any{value}
+		}
+
+		for _, v := range list {
+			if err := flags.Set(name, fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("invalid value for option '%s' in config file %s: %v", name, configPath, err)
+			}
+		}
+	}
+
+	return nil
+}
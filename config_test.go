@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	config := `{"max-bytes": 1000000, "timeout": 2.5, "chain": "base", "remap": ["a=b", "c=d"], "unknown": 1}`
+	if err := os.WriteFile(configPath, []byte(config), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	maxBytes := flags.Int64("max-bytes", 0, "")
+	timeout := flags.Float64("timeout", 0, "")
+	chain := flags.String("chain", "", "")
+	var remaps []string
+	flags.Func("remap", "", func(v string) error {
+		remaps = append(remaps, v)
+		return nil
+	})
+
+	if err := loadConfigFile(flags, configPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if *maxBytes != 1000000 {
+		t.Errorf("max-bytes = %d, want 1000000", *maxBytes)
+	}
+	if *timeout != 2.5 {
+		t.Errorf("timeout = %v, want 2.5", *timeout)
+	}
+	if *chain != "base" {
+		t.Errorf("chain = %q, want base", *chain)
+	}
+	if fmt.Sprint(remaps) != "[a=b c=d]" {
+		t.Errorf("remap = %q, want [a=b c=d]", remaps)
+	}
+}
+
+func TestLoadConfigFileMissing(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	if err := loadConfigFile(flags, filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("loadConfigFile() = %v, want nil", err)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"path"
+	"strings"
+)
+
+const (
+	diamondDirName string = "diamond"
+	facetsDirName  string = "facets"
+)
+
+// facetAddressesSelector is the selector of facetAddresses(), the function
+// of the EIP-2535 loupe returning the addresses of all the facets.
+var facetAddressesSelector = []byte{0x52, 0xef, 0x6b, 0x2c}
+
+// fetchDiamond writes the source code of an EIP-2535 diamond into the
+// diamond directory of targetDir, and the source code of each of its facets
+// into facets/<address>. A facet that can not be fetched does not stop the
+// others, the failures are reported together. It returns the number of
+// source code files written.
+func fetchDiamond(f *fetcher, diamondAddress, targetDir string, cfg *config) (int, error) {
+	facets, err := getFacetAddresses(f, cfg, diamondAddress)
+	if err != nil {
+		return 0, err
+	}
+	infof("%s: %d facets", diamondAddress, len(facets))
+
+	contractCfg := *cfg
+	contractCfg.Diamond = false
+
+	total, err := fetchContract(f, diamondAddress, path.Join(targetDir, diamondDirName), &contractCfg)
+	if err != nil {
+		return total, err
+	}
+
+	failures := []string{}
+	var wErr *writeError
+	for _, facet := range facets {
+		// diamonds usually register their own functions as a facet
+		if strings.EqualFold(facet, diamondAddress) {
+			continue
+		}
+
+		count, err := fetchContract(f, facet, path.Join(targetDir, facetsDirName, facet), &contractCfg)
+		total += count
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", facet, err))
+			errors.As(err, &wErr)
+		}
+	}
+
+	if len(failures) > 0 {
+		err := fmt.Errorf("%d out of %d facets failed:\n  %s", len(failures), len(facets), strings.Join(failures, "\n  "))
+		if wErr != nil {
+			return total, &writeError{err}
+		}
+		return total, err
+	}
+
+	return total, nil
+}
+
+// getFacetAddresses calls the loupe of the diamond to get the addresses of
+// its facets.
+func getFacetAddresses(f *fetcher, cfg *config, diamondAddress string) ([]string, error) {
+	raw, err := callContract(f, cfg.Chain, cfg.APIKey, diamondAddress, facetAddressesSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses, err := decodeAddressArray(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s does not look like a diamond, facetAddresses() returned an unexpected result: %v", diamondAddress, err)
+	}
+
+	return addresses, nil
+}
+
+// decodeAddressArray decodes the ABI encoding of an address[] returned by
+// a function.
+func decodeAddressArray(raw []byte) ([]string, error) {
+	word := func(i int) (*big.Int, error) {
+		if len(raw) < (i+1)*32 {
+			return nil, errors.New("the result is too short")
+		}
+		return new(big.Int).SetBytes(raw[i*32 : (i+1)*32]), nil
+	}
+
+	offset, err := word(0)
+	if err != nil {
+		return nil, err
+	}
+	if !offset.IsInt64() || offset.Int64()%32 != 0 || offset.Int64() > int64(len(raw)) {
+		return nil, errors.New("invalid array offset")
+	}
+	start := int(offset.Int64() / 32)
+
+	length, err := word(start)
+	if err != nil {
+		return nil, err
+	}
+	if !length.IsInt64() || length.Int64() > int64(len(raw)/32) {
+		return nil, errors.New("invalid array length")
+	}
+
+	addresses := []string{}
+	for i := 0; i < int(length.Int64()); i++ {
+		if _, err := word(start + 1 + i); err != nil {
+			return nil, err
+		}
+		element := raw[(start+1+i)*32 : (start+2+i)*32]
+		addresses = append(addresses, "0x"+hex.EncodeToString(element[12:]))
+	}
+
+	return addresses, nil
+}
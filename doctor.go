@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// runDoctor checks the setup needed to fetch contracts and prints the
+// effective configuration.
+func runDoctor(name string, args []string) int {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	sf := addSourceFlags(fs)
+	parseFlags(fs, name, args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return exitError
+	}
+
+	cfg, f, err := sf.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+
+	fmt.Println("Configuration:")
+	fmt.Printf("  chain: %s (id %d)\n", cfg.Chain.Name, cfg.Chain.ID)
+	fmt.Printf("  explorer: %s\n", cfg.Chain.ExplorerURL)
+	fmt.Printf("  API: %s\n", valueOrNone(cfg.Chain.APIURL))
+	fmt.Printf("  API key: %s\n", maskSecret(cfg.APIKey))
+	fmt.Printf("  cache directory: %s\n", valueOrNone(f.cacheDir))
+	if configPath, err := configFilePath(); err == nil {
+		fmt.Printf("  config file: %s\n", configPath)
+	}
+
+	fmt.Println("\nChecks:")
+	failed := false
+	check := func(name string, err error) {
+		if err != nil {
+			failed = true
+			fmt.Printf("  %s: FAIL: %v\n", name, err)
+			return
+		}
+		fmt.Printf("  %s: ok\n", name)
+	}
+
+	check("explorer reachable", checkExplorer(f, cfg.Chain.ExplorerURL))
+	check("API key", checkAPIKey(f, cfg))
+	check("cache directory writable", checkCacheDir(f.cacheDir))
+
+	if failed {
+		return exitError
+	}
+	return 0
+}
+
+// checkExplorer tells whether the explorer answers with a 2xx status. The
+// request bypasses the cache, since a cached page does not tell whether
+// the explorer is reachable now.
+func checkExplorer(f *fetcher, explorerURL string) error {
+	if f.noNetwork {
+		return errors.New("network access is disabled")
+	}
+
+	resp, err := f.client.Get(explorerURL)
+	if err != nil {
+		return fmt.Errorf("get request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("the explorer answered with status %s, it may be blocking this client", resp.Status)
+	}
+
+	return nil
+}
+
+// checkAPIKey makes a cheap API call to tell whether the API key works.
+// Like checkExplorer, the call bypasses the cache.
+func checkAPIKey(f *fetcher, cfg *config) error {
+	if cfg.APIKey == "" {
+		return errors.New("no API key, set it with -api-key or ETHERSCAN_API_KEY")
+	}
+	if f.noNetwork {
+		return errors.New("network access is disabled")
+	}
+
+	uncached := *f
+	uncached.cacheDir = ""
+
+	params := url.Values{}
+	params.Set("module", "account")
+	params.Set("action", "balance")
+	params.Set("address", "0x0000000000000000000000000000000000000000")
+	params.Set("tag", "latest")
+
+	var balance string
+	return getAPI(&uncached, cfg.Chain, cfg.APIKey, params, &balance)
+}
+
+// checkCacheDir tells whether files can be created in the cache
+// directory. Not using a cache directory is not an error.
+func checkCacheDir(cacheDir string) error {
+	if cacheDir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(cacheDir, 0750); err != nil {
+		return fmt.Errorf("could not create directory '%s': %v", cacheDir, err)
+	}
+
+	file, err := os.CreateTemp(cacheDir, ".doctor-*")
+	if err != nil {
+		return fmt.Errorf("could not create a file in '%s': %v", cacheDir, err)
+	}
+	file.Close()
+
+	return os.Remove(file.Name())
+}
+
+// maskSecret hides all but the last characters of a secret.
+func maskSecret(secret string) string {
+	if secret == "" {
+		return "none"
+	}
+	if len(secret) <= 4 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
+}
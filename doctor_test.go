@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCheckExplorer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/blocked" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("<html>Just a moment...</html>"))
+			return
+		}
+		_, _ = w.Write([]byte("<html></html>"))
+	}))
+	defer srv.Close()
+
+	f := newFetcher(fetcherOptions{})
+	if err := checkExplorer(f, srv.URL+"/"); err != nil {
+		t.Errorf("checkExplorer() = %v, want nil", err)
+	}
+	if err := checkExplorer(f, srv.URL+"/blocked"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("checkExplorer() = %v, want the 403 status", err)
+	}
+
+	f = newFetcher(fetcherOptions{NoNetwork: true})
+	if err := checkExplorer(f, srv.URL+"/"); err == nil {
+		t.Error("checkExplorer() without network did not fail")
+	}
+}
+
+func TestCheckAPIKeyUncached(t *testing.T) {
+	cacheDir := t.TempDir()
+	cfg := &config{Chain: apiServer(t, "balance"), APIKey: "key"}
+
+	f := newFetcher(fetcherOptions{CacheDir: cacheDir})
+	if err := checkAPIKey(f, cfg); err != nil {
+		t.Fatalf("checkAPIKey() = %v, want nil", err)
+	}
+	if entries, _ := os.ReadDir(cacheDir); len(entries) != 0 {
+		t.Errorf("checkAPIKey() left %d entries in the cache", len(entries))
+	}
+
+	// a cached answer does not tell whether the key works now
+	var balance string
+	if err := getAPI(f, cfg.Chain, cfg.APIKey, url.Values{"module": {"account"}, "action": {"balance"}}, &balance); err != nil {
+		t.Fatal(err)
+	}
+	f = newFetcher(fetcherOptions{CacheDir: cacheDir, NoNetwork: true})
+	if err := checkAPIKey(f, cfg); err == nil {
+		t.Error("checkAPIKey() without network did not fail")
+	}
+}
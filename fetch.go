@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// fetcher downloads the pages from the explorer. When cacheDir is set,
+// responses are stored there and revalidated with conditional requests on
+// subsequent fetches.
+type fetcher struct {
+	client   *http.Client
+	cacheDir string
+	limiter  *rateLimiter
+	maxBytes int64
+
+	// noNetwork makes every request that can not be answered from the
+	// cache fail instead of being sent
+	noNetwork bool
+
+	// renderURL is the rendering service the explorer pages are fetched
+	// through, empty to fetch them directly
+	renderURL string
+
+	// timings records the time spent fetching and parsing, nil if it is
+	// not measured
+	timings *stageTimings
+
+	// ctx is the context of the requests, which cancels the ones in flight
+	ctx context.Context
+}
+
+type fetcherOptions struct {
+	CacheDir string
+
+	// RPS is the maximum number of requests per second, 0 means no limit
+	RPS float64
+
+	// MaxBytes is the maximum size of a response body, 0 means no limit
+	MaxBytes int64
+
+	// Timeout is the maximum duration of a request, 0 means no timeout
+	Timeout time.Duration
+
+	// NoNetwork answers the requests from the cache without revalidating
+	// them, and fails instead of sending the ones that are not cached.
+	NoNetwork bool
+
+	// RenderURL is the endpoint of a rendering service, such as a headless
+	// browser, that the explorer pages are fetched through
+	RenderURL string
+}
+
+// rateLimiter spaces out requests so that no more than rps requests are
+// sent per second. A nil rateLimiter does not limit anything.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(rps float64) *rateLimiter {
+	if rps <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / rps)}
+}
+
+func (l *rateLimiter) wait() {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	start := l.next
+	if start.Before(now) {
+		start = now
+	}
+	l.next = start.Add(l.interval)
+	l.mu.Unlock()
+
+	time.Sleep(time.Until(start))
+}
+
+type cacheEntryMeta struct {
+	URL          string
+	ETag         string
+	LastModified string
+}
+
+func newFetcher(opts fetcherOptions) *fetcher {
+	return &fetcher{
+		client:    &http.Client{Timeout: opts.Timeout},
+		cacheDir:  opts.CacheDir,
+		limiter:   newRateLimiter(opts.RPS),
+		maxBytes:  opts.MaxBytes,
+		noNetwork: opts.NoNetwork,
+		renderURL: opts.RenderURL,
+		ctx:       context.Background(),
+	}
+}
+
+// withContext returns a copy of the fetcher whose requests use ctx. The
+// copy shares the client, the cache and the rate limiter of f.
+func (f *fetcher) withContext(ctx context.Context) *fetcher {
+	c := *f
+	c.ctx = ctx
+	return &c
+}
+
+func (f *fetcher) get(url string) ([]byte, error) {
+	body, _, err := f.getFollowed(url)
+	return body, err
+}
+
+// getFollowed is like get, but it also returns the URL of the response
+// after following redirects. Responses whose status is not 2xx are a
+// *httpStatusError, except a 304 for a cached response, which gives the
+// cached body.
+func (f *fetcher) getFollowed(url string) ([]byte, string, error) {
+	defer f.timings.track(stageFetch, time.Now())
+
+	req, err := http.NewRequestWithContext(f.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not create request: %v", err)
+	}
+
+	var cachedBody []byte
+	if f.cacheDir != "" {
+		meta, body, err := f.readCache(url)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if meta != nil {
+			cachedBody = body
+			if meta.ETag != "" {
+				req.Header.Set("If-None-Match", meta.ETag)
+			}
+			if meta.LastModified != "" {
+				req.Header.Set("If-Modified-Since", meta.LastModified)
+			}
+		}
+	}
+
+	if f.noNetwork {
+		if cachedBody != nil {
+			return cachedBody, url, nil
+		}
+		return nil, "", fmt.Errorf("%s is not cached and network access is disabled", redactedURL(url))
+	}
+
+	f.limiter.wait()
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("get request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	finalURL := resp.Request.URL.String()
+
+	if resp.StatusCode == http.StatusNotModified && cachedBody != nil {
+		return cachedBody, finalURL, nil
+	}
+
+	var bodyReader io.Reader = resp.Body
+	if f.maxBytes > 0 {
+		bodyReader = io.LimitReader(resp.Body, f.maxBytes+1)
+	}
+
+	body, err := io.ReadAll(bodyReader)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not read response body: %v", err)
+	}
+
+	if f.maxBytes > 0 && int64(len(body)) > f.maxBytes {
+		return nil, "", fmt.Errorf("response from %s is larger than %d bytes", url, f.maxBytes)
+	}
+
+	// a 304 is only expected for the cached responses
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, "", &httpStatusError{URL: url, Status: resp.Status, Body: body}
+	}
+
+	if f.cacheDir != "" && resp.StatusCode == http.StatusOK {
+		meta := cacheEntryMeta{
+			URL:          redactedURL(url),
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		}
+		if err := f.writeCache(meta, body); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return body, finalURL, nil
+}
+
+// httpStatusError is returned by get and getFollowed for the responses
+// whose status is not 2xx. The body is kept, since APIs explain the error
+// in it.
+type httpStatusError struct {
+	URL    string
+	Status string
+	Body   []byte
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("get request to %s failed with status %s", e.URL, e.Status)
+}
+
+// cachePaths returns the paths of the metadata and the body of the cache
+// entry of url. The API key is left out of the key of the entry, so that
+// the entries are shared by every key.
+func (f *fetcher) cachePaths(url string) (string, string) {
+	sum := sha256.Sum256([]byte(redactedURL(url)))
+	key := hex.EncodeToString(sum[:])
+	return path.Join(f.cacheDir, key+".json"), path.Join(f.cacheDir, key+".body")
+}
+
+// redactedURL returns rawURL without its apikey query parameter, so that
+// the API key is not saved in the cache.
+func redactedURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	query := u.Query()
+	if !query.Has("apikey") {
+		return rawURL
+	}
+	query.Del("apikey")
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+func (f *fetcher) readCache(url string) (*cacheEntryMeta, []byte, error) {
+	metaPath, bodyPath := f.cachePaths(url)
+
+	rawMeta, err := os.ReadFile(metaPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read cache file %s: %v", metaPath, err)
+	}
+
+	meta := &cacheEntryMeta{}
+	if err := json.Unmarshal(rawMeta, meta); err != nil {
+		// a corrupt entry is treated as a cache miss
+		return nil, nil, nil
+	}
+
+	body, err := os.ReadFile(bodyPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read cache file %s: %v", bodyPath, err)
+	}
+
+	return meta, body, nil
+}
+
+func (f *fetcher) writeCache(meta cacheEntryMeta, body []byte) error {
+	if err := os.MkdirAll(f.cacheDir, 0750); err != nil {
+		return fmt.Errorf("could not create cache directory '%s': %v", f.cacheDir, err)
+	}
+
+	metaPath, bodyPath := f.cachePaths(meta.URL)
+	if err := os.WriteFile(bodyPath, body, 0640); err != nil {
+		return fmt.Errorf("could not write cache file %s: %v", bodyPath, err)
+	}
+
+	rawMeta, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("could not encode cache metadata: %v", err)
+	}
+	if err := os.WriteFile(metaPath, rawMeta, 0640); err != nil {
+		return fmt.Errorf("could not write cache file %s: %v", metaPath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			_, _ = w.Write([]byte("ok"))
+		case "/created":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte("created"))
+		case "/cached":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = w.Write([]byte("cached"))
+		case "/not-modified":
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"Not Found"}`))
+		}
+	}))
+	defer srv.Close()
+
+	f := newFetcher(fetcherOptions{CacheDir: t.TempDir()})
+
+	tests := []struct {
+		path   string
+		want   string
+		status string
+	}{
+		{"/ok", "ok", ""},
+		{"/created", "created", ""},
+		{"/missing", "", "404 Not Found"},
+		// a 304 without a cached response is not a valid answer
+		{"/not-modified", "", "304 Not Modified"},
+		{"/cached", "cached", ""},
+		// the second request is revalidated and answered with a 304
+		{"/cached", "cached", ""},
+	}
+
+	for _, tt := range tests {
+		body, err := f.get(srv.URL + tt.path)
+		if tt.status == "" {
+			if err != nil || string(body) != tt.want {
+				t.Errorf("get(%s) = %q, %v, want %q", tt.path, body, err, tt.want)
+			}
+			continue
+		}
+
+		var statusErr *httpStatusError
+		if !errors.As(err, &statusErr) || statusErr.Status != tt.status {
+			t.Errorf("get(%s) error = %v, want status %s", tt.path, err, tt.status)
+		}
+	}
+}
+
+func TestCacheRedactsAPIKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"1"}`))
+	}))
+	defer srv.Close()
+
+	cacheDir := t.TempDir()
+	f := newFetcher(fetcherOptions{CacheDir: cacheDir})
+	if _, err := f.get(srv.URL + "/api?module=contract&apikey=SECRETKEY1"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		content, err := os.ReadFile(filepath.Join(cacheDir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(content), "SECRETKEY1") {
+			t.Errorf("cache file %s contains the API key", entry.Name())
+		}
+	}
+
+	// the entry is shared by every API key
+	f = newFetcher(fetcherOptions{CacheDir: cacheDir, NoNetwork: true})
+	if _, err := f.get(srv.URL + "/api?module=contract&apikey=SECRETKEY2"); err != nil {
+		t.Errorf("the entry is not used with another API key: %v", err)
+	}
+}
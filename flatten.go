@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	flattenOrderTopological string = "topological"
+	flattenOrderEtherscan   string = "etherscan"
+)
+
+// flattenFiles concatenates all the files into a single source. With the
+// topological order every file is placed after the files it imports, and
+// with the etherscan order files follow their order in the explorer page.
+// Import statements are removed and only the first SPDX license identifier
+// is kept, since the compiler rejects sources with more than one.
+func flattenFiles(files map[FileName]*SourceCodeFile, order string) string {
+	ordered := topologicalOrder(files)
+	if order == flattenOrderEtherscan {
+		ordered = make([]*SourceCodeFile, 0, len(files))
+		for _, name := range explorerOrder(files) {
+			ordered = append(ordered, files[name])
+		}
+	}
+
+	sb := &strings.Builder{}
+	licenseFound := false
+	for i, f := range ordered {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+
+		filePath, err := outputPath(f)
+		if err != nil {
+			filePath = f.Name
+		}
+		fmt.Fprintf(sb, "// File: %s\n\n", filePath)
+
+		for _, imp := range f.RemoteImports {
+			warnf("remote import '%s' in %s is not included in the flattened source", imp, f.Name)
+		}
+
+		lines := strings.Split(f.RawContent, "\n")
+		imports := importLines(f.Name, lines)
+		for i := 0; i < len(lines); i++ {
+			if imports[i] {
+				// import statements can span several lines
+				_, i = importStatement(lines, i)
+				continue
+			}
+			line := lines[i]
+
+			if strings.Contains(line, "SPDX-License-Identifier:") {
+				if licenseFound {
+					line = strings.Replace(line, "SPDX-License-Identifier:", "License:", 1)
+				}
+				licenseFound = true
+			}
+
+			sb.WriteString(line)
+			sb.WriteString("\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// topologicalOrder returns the files sorted so that every file comes after
+// its dependencies. Files are visited by name to keep the order stable, and
+// import cycles are broken at the first file of the cycle that is visited.
+func topologicalOrder(files map[FileName]*SourceCodeFile) []*SourceCodeFile {
+	names := make([]FileName, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	visited := map[FileName]bool{}
+	ordered := []*SourceCodeFile{}
+
+	var visit func(name FileName)
+	visit = func(name FileName) {
+		f, ok := files[name]
+		if !ok || visited[name] {
+			return
+		}
+		visited[name] = true
+
+		for _, dependency := range f.Dependencies {
+			visit(dependency)
+		}
+		ordered = append(ordered, f)
+	}
+
+	for _, name := range names {
+		visit(name)
+	}
+
+	return ordered
+}
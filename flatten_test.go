@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFlattenFilesImports(t *testing.T) {
+	files := newBundle(map[FileName]string{
+		"Main.sol": "// SPDX-License-Identifier: MIT\n" +
+			"import {\n    Lib\n} from \"./Lib.sol\";\n" +
+			"/*\nimport \"./Commented.sol\";\n*/\n" +
+			"contract Main {\n    function f() public {\n        assembly {\n            import := 1\n        }\n    }\n}\n",
+		"Lib.sol": "// SPDX-License-Identifier: MIT\nlibrary Lib {}\n",
+	})
+	if err := fillPaths(files, defaultPathOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	flat := flattenFiles(files, flattenOrderTopological)
+
+	if strings.Contains(flat, "from \"./Lib.sol\"") || strings.Contains(flat, "    Lib\n}") {
+		t.Errorf("the multi-line import is kept:\n%s", flat)
+	}
+	for _, kept := range []string{"import \"./Commented.sol\";", "import := 1", "contract Main {", "library Lib {}"} {
+		if !strings.Contains(flat, kept) {
+			t.Errorf("%q is missing:\n%s", kept, flat)
+		}
+	}
+	if strings.Index(flat, "library Lib") > strings.Index(flat, "contract Main") {
+		t.Errorf("Lib.sol is not before Main.sol:\n%s", flat)
+	}
+	if strings.Count(flat, "SPDX-License-Identifier:") != 1 {
+		t.Errorf("more than one license identifier:\n%s", flat)
+	}
+}
@@ -2,34 +2,414 @@ package main
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 	"path"
+	"sort"
 	"strings"
+	"sync"
+	"unicode/utf8"
 )
 
-func writeAllFiles(files map[FileName]*SourceCodeFile, dstPath string) (int, error) {
-	filesWritten := 0
+// FileWriter is the minimal set of filesystem operations needed to save the
+// source code files.
+type FileWriter interface {
+	MkdirAll(path string, perm fs.FileMode) error
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// osFileWriter writes the files to disk.
+type osFileWriter struct{}
+
+func (osFileWriter) MkdirAll(path string, perm fs.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (osFileWriter) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+// memFileWriter keeps the written files in memory.
+type memFileWriter struct {
+	mu    sync.Mutex
+	Dirs  map[string]bool
+	Files map[string][]byte
+}
+
+func newMemFileWriter() *memFileWriter {
+	return &memFileWriter{
+		Dirs:  map[string]bool{},
+		Files: map[string][]byte{},
+	}
+}
+
+func (m *memFileWriter) MkdirAll(dirPath string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for p := path.Clean(dirPath); p != "." && p != "/"; p = path.Dir(p) {
+		m.Dirs[p] = true
+	}
+
+	return nil
+}
 
+func (m *memFileWriter) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = path.Clean(name)
+	if dir := path.Dir(name); dir != "." && dir != "/" && !m.Dirs[dir] {
+		return fmt.Errorf("open %s: %w", name, fs.ErrNotExist)
+	}
+
+	m.Files[name] = append([]byte{}, data...)
+	return nil
+}
+
+// outputPath returns the path where the file is written, relative to the
+// target directory.
+func outputPath(f *SourceCodeFile) (string, error) {
+	if len(f.PathFields) == 0 || f.PathFields[0] != rootDirName {
+		return "", fmt.Errorf(
+			"file %s does not have a complete path: %s",
+			f.Name,
+			strings.Join(f.PathFields, "/"))
+	}
+
+	return path.Join(strings.Join(f.PathFields[1:], "/"), f.Name), nil
+}
+
+// planFiles returns the content of every file indexed by its path relative
+// to the target directory.
+func planFiles(files map[FileName]*SourceCodeFile) (map[string]string, error) {
+	plan := map[string]string{}
 	for _, f := range files {
-		if len(f.PathFields) == 0 || f.PathFields[0] != rootDirName {
-			return filesWritten, fmt.Errorf(
-				"file %s does not have a complete path: %s",
-				f.Name,
-				strings.Join(f.PathFields, "/"))
+		relPath, err := outputPath(f)
+		if err != nil {
+			return nil, err
 		}
+		plan[relPath] = f.RawContent
+	}
+
+	return plan, nil
+}
+
+type writeOptions struct {
+	// StripBOM removes byte order marks, zero width characters and control
+	// characters other than tabs and line breaks from the content.
+	StripBOM bool
+
+	// Partial writes the files whose path could not be resolved into the
+	// unresolved directory instead of failing.
+	Partial bool
+
+	// Provenance, when not empty, is the source description written in a
+	// comment at the top of every file, followed by the file's path.
+	Provenance string
 
-		dirPath := path.Join(dstPath, strings.Join(f.PathFields[1:], "/"))
-		if err := os.MkdirAll(dirPath, 0750); err != nil {
-			return filesWritten, fmt.Errorf("could not create directory '%s': %v", dirPath, err)
+	// Flat writes all the files directly in the target directory, adding
+	// a numeric suffix to the names that collide.
+	Flat bool
+
+	// Workers is the number of files written concurrently, at least one.
+	Workers int
+
+	// ModuleRoot is a relative path prepended to the path of every file.
+	ModuleRoot string
+
+	// RootName is the name of the directory written in place of the root
+	// of the reconstructed tree, under ModuleRoot. An empty value writes
+	// the root into the target directory itself.
+	RootName string
+
+	// InvalidUTF8 is what to do with content that is not valid UTF-8: keep
+	// it as is, sanitize it or fail. An empty value means keep.
+	InvalidUTF8 string
+
+	// NormalizeEOL rewrites the line endings of every file to the style
+	// used by most of the lines of the bundle.
+	NormalizeEOL bool
+}
+
+const (
+	invalidUTF8Keep     string = "keep"
+	invalidUTF8Sanitize string = "sanitize"
+	invalidUTF8Error    string = "error"
+)
+
+const unresolvedDirName string = "_unresolved"
+const flatMapFileName string = "flat-map.txt"
+
+// writePaths returns the path relative to the target directory where each
+// file is written with the given options, and the files whose path could
+// not be resolved.
+func writePaths(files map[FileName]*SourceCodeFile, opts writeOptions) (map[FileName]string, []FileName, error) {
+	names := make([]FileName, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	moduleRoot := path.Clean(opts.ModuleRoot)
+	if path.IsAbs(moduleRoot) || moduleRoot == ".." || strings.HasPrefix(moduleRoot, "../") {
+		return nil, nil, fmt.Errorf("module root '%s' must be a path inside the target directory", opts.ModuleRoot)
+	}
+	if opts.RootName != "" && (opts.RootName == "." || opts.RootName == ".." || strings.Contains(opts.RootName, "/")) {
+		return nil, nil, fmt.Errorf("root name '%s' must be the name of a directory", opts.RootName)
+	}
+
+	relPaths := map[FileName]string{}
+	unresolved := []FileName{}
+	used := map[string]bool{}
+	for _, name := range names {
+		f := files[name]
+
+		if opts.Flat {
+			relPaths[name] = path.Join(moduleRoot, flatName(f.Name, used))
+			continue
 		}
 
-		filePath := path.Join(dirPath, f.Name)
-		if err := os.WriteFile(filePath, []byte(f.RawContent), 0640); err != nil {
-			return filesWritten, fmt.Errorf("could not save file %s: %v", filePath, err)
+		relPath, err := outputPath(f)
+		if err != nil {
+			if !opts.Partial {
+				return nil, nil, err
+			}
+
+			unresolved = append(unresolved, name)
+			relPaths[name] = path.Join(moduleRoot, unresolvedDirName, f.Name)
+			continue
 		}
+		relPaths[name] = path.Join(moduleRoot, opts.RootName, relPath)
+	}
+
+	return relPaths, unresolved, nil
+}
 
-		filesWritten++
+// flatName returns name, or name with the lowest numeric suffix that is not
+// used yet, and marks it as used.
+func flatName(name string, used map[string]bool) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	candidate := name
+	for i := 1; used[candidate] || candidate == flatMapFileName; i++ {
+		candidate = fmt.Sprintf("%s_%d%s", base, i, ext)
 	}
+	used[candidate] = true
+
+	return candidate
+}
 
-	return filesWritten, nil
+// existingFiles returns the files in dstPath that would be overwritten by
+// writeAllFiles.
+func existingFiles(files map[FileName]*SourceCodeFile, dstPath string, opts writeOptions) []string {
+	relPaths, _, err := writePaths(files, opts)
+	if err != nil {
+		return nil
+	}
+
+	existing := []string{}
+	for _, relPath := range relPaths {
+		filePath := path.Join(dstPath, relPath)
+		if _, err := os.Stat(filePath); err == nil {
+			existing = append(existing, filePath)
+		}
+	}
+	sort.Strings(existing)
+
+	return existing
+}
+
+func writeAllFiles(fw FileWriter, files map[FileName]*SourceCodeFile, dstPath string, opts writeOptions) ([]string, error) {
+	switch opts.InvalidUTF8 {
+	case "", invalidUTF8Keep, invalidUTF8Sanitize, invalidUTF8Error:
+	default:
+		return nil, fmt.Errorf("unknown invalid UTF-8 handling '%s'", opts.InvalidUTF8)
+	}
+
+	relPaths, unresolved, err := writePaths(files, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range unresolved {
+		warnf("file %s does not have a complete path, saving it in %s", name, unresolvedDirName)
+	}
+
+	eol := ""
+	if opts.NormalizeEOL {
+		eol = dominantEOL(files)
+	}
+
+	workers := max(opts.Workers, 1)
+	pending := make(chan *SourceCodeFile)
+
+	mu := sync.Mutex{}
+	written := []string{}
+	var firstErr error
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range pending {
+				filePath, err := writeFile(fw, f, relPaths[f.Name], dstPath, eol, opts)
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				if err == nil {
+					written = append(written, filePath)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, f := range files {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+
+		pending <- f
+	}
+	close(pending)
+	wg.Wait()
+
+	sort.Strings(written)
+	if firstErr != nil {
+		return written, firstErr
+	}
+
+	if opts.Flat {
+		if err := writeFlatMap(fw, files, relPaths, dstPath, opts.ModuleRoot); err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// writeFile saves a single file at relPath inside dstPath and returns the
+// path of the written file. When eol is not empty, every line ending is
+// rewritten to it. MkdirAll is idempotent, so concurrent calls for the same
+// directory are safe.
+func writeFile(fw FileWriter, f *SourceCodeFile, relPath, dstPath, eol string, opts writeOptions) (string, error) {
+	filePath := path.Join(dstPath, relPath)
+	dirPath := path.Dir(filePath)
+	if err := fw.MkdirAll(dirPath, 0750); err != nil {
+		return "", fmt.Errorf("could not create directory '%s': %v", dirPath, err)
+	}
+
+	content := f.RawContent
+	if !utf8.ValidString(content) {
+		switch opts.InvalidUTF8 {
+		case invalidUTF8Sanitize:
+			content = strings.ToValidUTF8(content, string(utf8.RuneError))
+		case invalidUTF8Error:
+			return "", fmt.Errorf("file %s contains invalid UTF-8", f.Name)
+		}
+	}
+
+	if opts.StripBOM {
+		content = stripInvisibleChars(content)
+	}
+
+	if eol != "" {
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+		if eol != "\n" {
+			content = strings.ReplaceAll(content, "\n", eol)
+		}
+	}
+
+	if opts.Provenance != "" {
+		commentEOL := "\n"
+		if eol != "" {
+			commentEOL = eol
+		}
+		content = fmt.Sprintf("// concode: %s %s%s", opts.Provenance, relPath, commentEOL) + content
+	}
+
+	if err := fw.WriteFile(filePath, []byte(content), 0640); err != nil {
+		return "", fmt.Errorf("could not save file %s: %v", filePath, err)
+	}
+
+	return filePath, nil
+}
+
+// writeFlatMap saves the mapping between the flat name of each file and the
+// path it would have in the reconstructed tree, next to the flat files in
+// the module root.
+func writeFlatMap(fw FileWriter, files map[FileName]*SourceCodeFile, relPaths map[FileName]string, dstPath, moduleRoot string) error {
+	lines := []string{}
+	for name, f := range files {
+		originalPath, err := outputPath(f)
+		if err != nil {
+			originalPath = path.Join(unresolvedDirName, f.Name)
+		}
+		lines = append(lines, path.Base(relPaths[name])+"\t"+originalPath)
+	}
+	sort.Strings(lines)
+
+	dirPath := path.Join(dstPath, moduleRoot)
+	if err := fw.MkdirAll(dirPath, 0750); err != nil {
+		return fmt.Errorf("could not create directory '%s': %v", dirPath, err)
+	}
+
+	mapPath := path.Join(dirPath, flatMapFileName)
+	if err := fw.WriteFile(mapPath, []byte(strings.Join(lines, "\n")+"\n"), 0640); err != nil {
+		return fmt.Errorf("could not save file %s: %v", mapPath, err)
+	}
+
+	return nil
+}
+
+// dominantEOL returns the line ending used by most of the lines of the
+// files, "\r\n" or "\n". Ties are resolved in favor of "\n".
+func dominantEOL(files map[FileName]*SourceCodeFile) string {
+	crlf, lf := 0, 0
+	for _, f := range files {
+		n := strings.Count(f.RawContent, "\r\n")
+		crlf += n
+		lf += strings.Count(f.RawContent, "\n") - n
+	}
+
+	if crlf > lf {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// stripInvisibleChars removes the byte order marks, the zero width
+// characters and the control characters other than tabs and line endings.
+// Bytes that are not valid UTF-8 are kept as they are.
+func stripInvisibleChars(content string) string {
+	sb := strings.Builder{}
+	sb.Grow(len(content))
+	for i := 0; i < len(content); {
+		r, size := utf8.DecodeRuneInString(content[i:])
+		if !isInvisibleChar(r) {
+			sb.WriteString(content[i : i+size])
+		}
+		i += size
+	}
+	return sb.String()
+}
+
+func isInvisibleChar(r rune) bool {
+	switch {
+	case r == '\t' || r == '\n' || r == '\r':
+		return false
+	case r < 0x20 || r == 0x7f:
+		return true
+	case r == '\ufeff' || r == '\u200b' || r == '\u200c' || r == '\u200d' || r == '\u2060':
+		return true
+	}
+	return false
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowFileWriter is a memFileWriter that takes some time to write every
+// file, as a slow disk does, and fails for the files named failName.
+type slowFileWriter struct {
+	*memFileWriter
+	latency  time.Duration
+	failName string
+}
+
+func (w *slowFileWriter) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	time.Sleep(w.latency)
+	if w.failName != "" && strings.HasSuffix(name, "/"+w.failName) {
+		return errors.New("disk full")
+	}
+	return w.memFileWriter.WriteFile(name, data, perm)
+}
+
+// largeTree returns n files placed in 10 directories.
+func largeTree(n int) map[FileName]*SourceCodeFile {
+	files := map[FileName]*SourceCodeFile{}
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("C%d.sol", i)
+		files[name] = &SourceCodeFile{
+			Name:       name,
+			RawContent: fmt.Sprintf("contract C%d {}\n", i),
+			PathFields: []string{rootDirName, "contracts", fmt.Sprintf("d%d", i%10)},
+		}
+	}
+	return files
+}
+
+func TestWriteAllFilesWorkers(t *testing.T) {
+	files := largeTree(200)
+
+	var first *memFileWriter
+	var firstWritten []string
+	for _, workers := range []int{0, 1, 8, 64} {
+		fw := newMemFileWriter()
+		written, err := writeAllFiles(fw, files, "out", writeOptions{Workers: workers})
+		if err != nil {
+			t.Fatalf("workers %d: %v", workers, err)
+		}
+		if len(written) != len(files) || !slices.IsSorted(written) {
+			t.Fatalf("workers %d: %d files written, sorted %t", workers, len(written), slices.IsSorted(written))
+		}
+
+		if first == nil {
+			first, firstWritten = fw, written
+			continue
+		}
+		if !slices.Equal(written, firstWritten) || !maps.EqualFunc(fw.Files, first.Files, func(a, b []byte) bool { return string(a) == string(b) }) {
+			t.Errorf("workers %d: the output differs from the one of a single worker", workers)
+		}
+	}
+}
+
+func TestWriteAllFilesWorkersError(t *testing.T) {
+	files := largeTree(200)
+	fw := &slowFileWriter{memFileWriter: newMemFileWriter(), failName: "C7.sol"}
+
+	written, err := writeAllFiles(fw, files, "out", writeOptions{Workers: 8})
+	if err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("err = %v, want the error of the failed file", err)
+	}
+	if slices.Contains(written, "out/contracts/d7/C7.sol") {
+		t.Errorf("the failed file is reported as written")
+	}
+	if len(written) == len(files) {
+		t.Errorf("all the files are reported as written")
+	}
+}
+
+func BenchmarkWriteAllFiles(b *testing.B) {
+	files := largeTree(200)
+	for _, workers := range []int{1, 8, 32} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				fw := &slowFileWriter{memFileWriter: newMemFileWriter(), latency: 100 * time.Microsecond}
+				if _, err := writeAllFiles(fw, files, "out", writeOptions{Workers: workers}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteFileStripBOMInvalidUTF8(t *testing.T) {
+	raw := "\ufeffcontract A {}\xff\u200b\n"
+
+	tests := []struct {
+		policy  string
+		want    string
+		wantErr bool
+	}{
+		{policy: invalidUTF8Keep, want: "contract A {}\xff\n"},
+		{policy: invalidUTF8Sanitize, want: "contract A {}\ufffd\n"},
+		{policy: invalidUTF8Error, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		fw := newMemFileWriter()
+		f := &SourceCodeFile{Name: "A.sol", RawContent: raw}
+		filePath, err := writeFile(fw, f, "A.sol", "out", "", writeOptions{StripBOM: true, InvalidUTF8: tt.policy})
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: no error for invalid UTF-8", tt.policy)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.policy, err)
+		}
+		if got := string(fw.Files[filePath]); got != tt.want {
+			t.Errorf("%s: content = %q, want %q", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestWriteAllFilesFlatModuleRoot(t *testing.T) {
+	files := map[FileName]*SourceCodeFile{
+		"A.sol": {Name: "A.sol", RawContent: "contract A {}\n", PathFields: []string{rootDirName, "src"}},
+		"B.sol": {Name: "B.sol", RawContent: "contract B {}\n", PathFields: []string{rootDirName, "lib"}},
+	}
+
+	fw := newMemFileWriter()
+	if _, err := writeAllFiles(fw, files, "out", writeOptions{Flat: true, ModuleRoot: "pkg/contracts"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"out/pkg/contracts/A.sol", "out/pkg/contracts/B.sol", "out/pkg/contracts/flat-map.txt"}
+	got := []string{}
+	for name := range fw.Files {
+		got = append(got, name)
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("written files = %v, want %v", got, want)
+	}
+	if got, want := string(fw.Files["out/pkg/contracts/flat-map.txt"]), "A.sol\tsrc/A.sol\nB.sol\tlib/B.sol\n"; got != want {
+		t.Errorf("flat-map.txt = %q, want %q", got, want)
+	}
+}
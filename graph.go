@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// dependencyGraph returns the dependencies between the files in DOT format.
+// Nodes are labeled with the resolved path of each file.
+func dependencyGraph(files map[FileName]*SourceCodeFile) string {
+	names := make([]FileName, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sb := &strings.Builder{}
+	sb.WriteString("digraph concode {\n")
+	for _, name := range names {
+		label, err := outputPath(files[name])
+		if err != nil {
+			label = name
+		}
+		fmt.Fprintf(sb, "\t%q [label=%q];\n", name, label)
+	}
+
+	for _, name := range names {
+		for _, dependency := range files[name].Dependencies {
+			if _, ok := files[dependency]; !ok {
+				continue
+			}
+			fmt.Fprintf(sb, "\t%q -> %q;\n", name, dependency)
+		}
+	}
+	sb.WriteString("}\n")
+
+	return sb.String()
+}
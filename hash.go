@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// sourceHash returns the keccak256 hash of the normalized sources of a
+// contract: the files sorted by name, each one with its whitespace
+// collapsed, so that identical code deployed at several addresses gets the
+// same hash regardless of formatting.
+func sourceHash(files map[FileName]*SourceCodeFile) string {
+	names := make([]FileName, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sb := &strings.Builder{}
+	for _, name := range names {
+		sb.WriteString(name)
+		sb.WriteString("\x00")
+		sb.WriteString(strings.Join(strings.Fields(files[name].RawContent), " "))
+		sb.WriteString("\x00")
+	}
+
+	sum := keccak256([]byte(sb.String()))
+	return "0x" + hex.EncodeToString(sum[:])
+}
+
+var keccakRoundConstants = [24]uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808a, 0x8000000080008000,
+	0x000000000000808b, 0x0000000080000001, 0x8000000080008081, 0x8000000000008009,
+	0x000000000000008a, 0x0000000000000088, 0x0000000080008009, 0x000000008000000a,
+	0x000000008000808b, 0x800000000000008b, 0x8000000000008089, 0x8000000000008003,
+	0x8000000000008002, 0x8000000000000080, 0x000000000000800a, 0x800000008000000a,
+	0x8000000080008081, 0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+var keccakRotations = [25]int{
+	0, 1, 62, 28, 27,
+	36, 44, 6, 55, 20,
+	3, 10, 43, 25, 39,
+	41, 45, 15, 21, 8,
+	18, 2, 61, 56, 14,
+}
+
+// keccakF1600 is the Keccak permutation, with the state indexed as
+// x + 5*y.
+func keccakF1600(a *[25]uint64) {
+	for round := 0; round < 24; round++ {
+		// theta
+		var c [5]uint64
+		for x := 0; x < 5; x++ {
+			c[x] = a[x] ^ a[x+5] ^ a[x+10] ^ a[x+15] ^ a[x+20]
+		}
+		for x := 0; x < 5; x++ {
+			d := c[(x+4)%5] ^ bits.RotateLeft64(c[(x+1)%5], 1)
+			for y := 0; y < 25; y += 5 {
+				a[x+y] ^= d
+			}
+		}
+
+		// rho and pi
+		var b [25]uint64
+		for x := 0; x < 5; x++ {
+			for y := 0; y < 5; y++ {
+				b[y+5*((2*x+3*y)%5)] = bits.RotateLeft64(a[x+5*y], keccakRotations[x+5*y])
+			}
+		}
+
+		// chi
+		for y := 0; y < 25; y += 5 {
+			for x := 0; x < 5; x++ {
+				a[x+y] = b[x+y] ^ (^b[(x+1)%5+y] & b[(x+2)%5+y])
+			}
+		}
+
+		// iota
+		a[0] ^= keccakRoundConstants[round]
+	}
+}
+
+// keccak256 is the hash used by Ethereum, which differs from SHA3-256 in
+// the padding.
+func keccak256(data []byte) [32]byte {
+	const rate = 136
+
+	var state [25]uint64
+	padded := append(append([]byte{}, data...), 0x01)
+	for len(padded)%rate != 0 {
+		padded = append(padded, 0)
+	}
+	padded[len(padded)-1] |= 0x80
+
+	for offset := 0; offset < len(padded); offset += rate {
+		for i := 0; i < rate/8; i++ {
+			state[i] ^= binary.LittleEndian.Uint64(padded[offset+i*8:])
+		}
+		keccakF1600(&state)
+	}
+
+	var sum [32]byte
+	for i := 0; i < 4; i++ {
+		binary.LittleEndian.PutUint64(sum[i*8:], state[i])
+	}
+	return sum
+}
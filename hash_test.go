@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestKeccak256(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"},
+		{"abc", "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45"},
+		// the rate is 136 bytes, so these cover the padding in the last
+		// byte of a block, a block of padding only, and a second block
+		{strings.Repeat("a", 135), "34367dc248bbd832f4e3e69dfaac2f92638bd0bbd18f2912ba4ef454919cf446"},
+		{strings.Repeat("a", 136), "a6c4d403279fe3e0af03729caada8374b5ca54d8065329a3ebcaeb4b60aa386e"},
+		{strings.Repeat("a", 137), "d869f639c7046b4929fc92a4d988a8b22c55fbadb802c0c66ebcd484f1915f39"},
+		{strings.Repeat("a", 272), "cf7fcd4f705ee749930d19ca84561a9bf62516bd90a471545fa2f49fdc7e63c8"},
+	}
+
+	for _, tt := range tests {
+		sum := keccak256([]byte(tt.input))
+		if got := hex.EncodeToString(sum[:]); got != tt.want {
+			t.Errorf("keccak256(%d bytes) = %s, want %s", len(tt.input), got, tt.want)
+		}
+	}
+}
+
+func TestSourceHash(t *testing.T) {
+	bundle := func(sources map[FileName]string) map[FileName]*SourceCodeFile {
+		files := map[FileName]*SourceCodeFile{}
+		for name, content := range sources {
+			files[name] = &SourceCodeFile{Name: name, RawContent: content}
+		}
+		return files
+	}
+
+	base := sourceHash(bundle(map[FileName]string{
+		"A.sol": "contract A {\n    uint x;\n}\n",
+		"B.sol": "contract B {}",
+	}))
+	if !strings.HasPrefix(base, "0x") || len(base) != 66 {
+		t.Fatalf("sourceHash() = %s, want a 0x prefixed keccak256 hash", base)
+	}
+
+	tests := []struct {
+		name    string
+		sources map[FileName]string
+		same    bool
+	}{
+		{"reformatted", map[FileName]string{"A.sol": "contract A {\r\n\tuint   x;\r\n}", "B.sol": "  contract B {}\n\n"}, true},
+		{"other file order", map[FileName]string{"B.sol": "contract B {}", "A.sol": "contract A {\n    uint x;\n}\n"}, true},
+		{"other code", map[FileName]string{"A.sol": "contract A {\n    uint y;\n}\n", "B.sol": "contract B {}"}, false},
+		{"renamed file", map[FileName]string{"A.sol": "contract A {\n    uint x;\n}\n", "C.sol": "contract B {}"}, false},
+		{"code moved between files", map[FileName]string{"A.sol": "contract A {\n    uint x;\n}\ncontract B {}", "B.sol": ""}, false},
+	}
+
+	for _, tt := range tests {
+		// the hash must not depend on the order of the map either
+		for i := 0; i < 10; i++ {
+			if got := sourceHash(bundle(tt.sources)); (got == base) != tt.same {
+				t.Errorf("%s: sourceHash() = %s, base %s, want same %t", tt.name, got, base, tt.same)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+const indexFileName string = "INDEX.md"
+const similarMatchFileName string = "SIMILAR_MATCH.txt"
+
+// buildIndex returns a markdown document listing every file grouped by
+// directory, with its pragma, license and imports.
+func buildIndex(files map[FileName]*SourceCodeFile, entry *SourceCodeFile, compilerVersion string) string {
+	byDir := map[string][]*SourceCodeFile{}
+	relPaths := map[*SourceCodeFile]string{}
+	for _, f := range files {
+		relPath, err := outputPath(f)
+		if err != nil {
+			// only reachable in partial mode, where these files are
+			// saved in the unresolved directory
+			relPath = path.Join(unresolvedDirName, f.Name)
+		}
+		relPaths[f] = relPath
+
+		dir := path.Dir(relPath)
+		byDir[dir] = append(byDir[dir], f)
+	}
+
+	dirs := make([]string, 0, len(byDir))
+	for dir := range byDir {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	sb := &strings.Builder{}
+	sb.WriteString("# Index\n")
+	if entry != nil {
+		fmt.Fprintf(sb, "\nEntry file: `%s`\n", relPaths[entry])
+	}
+	if compilerVersion != "" {
+		fmt.Fprintf(sb, "\nCompiler version: `%s`\n", compilerVersion)
+	}
+	for _, dir := range dirs {
+		dirFiles := byDir[dir]
+		sort.Slice(dirFiles, func(i, j int) bool { return dirFiles[i].Name < dirFiles[j].Name })
+
+		fmt.Fprintf(sb, "\n## %s\n", dir)
+		for _, f := range dirFiles {
+			fmt.Fprintf(sb, "\n### %s\n\n", f.Name)
+			fmt.Fprintf(sb, "- Path: `%s`\n", relPaths[f])
+			if f.Confidence != "" {
+				fmt.Fprintf(sb, "- Path confidence: %s\n", f.Confidence)
+			}
+			if f.Index > 0 {
+				fmt.Fprintf(sb, "- Explorer position: %d\n", f.Index)
+			}
+			fmt.Fprintf(sb, "- Pragma: %s\n", valueOrNone(f.Pragma))
+			if len(f.OtherPragmas) > 0 {
+				fmt.Fprintf(sb, "- Other pragmas: %s\n", strings.Join(f.OtherPragmas, ", "))
+			}
+			fmt.Fprintf(sb, "- License: %s\n", valueOrNone(f.License))
+			if len(f.Imports) == 0 {
+				sb.WriteString("- Imports: none\n")
+				continue
+			}
+
+			sb.WriteString("- Imports:\n")
+			for _, imp := range f.Imports {
+				fmt.Fprintf(sb, "  - `%s`\n", imp)
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+func writeIndex(fw FileWriter, files map[FileName]*SourceCodeFile, entry *SourceCodeFile, compilerVersion, dstPath string) error {
+	index := buildIndex(files, entry, compilerVersion)
+
+	if err := fw.MkdirAll(dstPath, 0750); err != nil {
+		return fmt.Errorf("could not create directory '%s': %v", dstPath, err)
+	}
+
+	indexPath := path.Join(dstPath, indexFileName)
+	if err := fw.WriteFile(indexPath, []byte(index), 0640); err != nil {
+		return fmt.Errorf("could not save file %s: %v", indexPath, err)
+	}
+
+	return nil
+}
+
+// writeSimilarMatchNote labels the output as the source of a similar
+// contract rather than the one requested.
+func writeSimilarMatchNote(fw FileWriter, contractAddress, similarMatch, dstPath string) error {
+	note := fmt.Sprintf(
+		"Contract %s is not verified.\n"+
+			"These files are the source of %s, which the explorer reports as a similar match.\n"+
+			"They are an approximation and may differ from the deployed code.\n",
+		contractAddress,
+		similarMatch)
+
+	notePath := path.Join(dstPath, similarMatchFileName)
+	if err := fw.WriteFile(notePath, []byte(note), 0640); err != nil {
+		return fmt.Errorf("could not save file %s: %v", notePath, err)
+	}
+
+	return nil
+}
+
+func valueOrNone(v string) string {
+	if v == "" {
+		return "none"
+	}
+	return v
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"path"
+	"sort"
+	"strings"
+)
+
+const defaultIPFSGateway string = "https://ipfs.io"
+
+// ipfsMetadataKey is the CBOR encoding of the "ipfs" key of the metadata
+// section of the bytecode, followed by the header of a 34 bytes string,
+// the multihash of the metadata file.
+var ipfsMetadataKey = []byte{0x64, 'i', 'p', 'f', 's', 0x58, 0x22}
+
+// solcMetadata is the part of the metadata file written by solc that is
+// needed to reconstruct the sources.
+type solcMetadata struct {
+	Compiler struct {
+		Version string `json:"version"`
+	} `json:"compiler"`
+	Settings struct {
+		CompilationTarget map[string]string `json:"compilationTarget"`
+		EVMVersion        string            `json:"evmVersion"`
+		ViaIR             bool              `json:"viaIR"`
+		Optimizer         struct {
+			Enabled bool `json:"enabled"`
+			Runs    int  `json:"runs"`
+		} `json:"optimizer"`
+		Libraries map[string]string `json:"libraries"`
+	} `json:"settings"`
+	Sources map[string]struct {
+		Content string   `json:"content"`
+		URLs    []string `json:"urls"`
+	} `json:"sources"`
+}
+
+// getIPFSFiles reconstructs the sources of a contract from the metadata
+// file pinned in IPFS, whose hash is embedded in the deployed bytecode.
+// The paths of the sources in the metadata are authoritative, so they are
+// not inferred from the imports.
+func getIPFSFiles(f *fetcher, contractAddress string, cfg *config) (*FetchResult, error) {
+	code, err := getDeployedBytecode(f, cfg, contractAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := hex.DecodeString(strings.TrimPrefix(code, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the bytecode of %s: %v", contractAddress, err)
+	}
+
+	cid, err := metadataCID(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", contractAddress, err)
+	}
+	infof("%s: metadata at ipfs://%s", contractAddress, cid)
+
+	rawMetadata, err := f.get(ipfsURL(cfg.IPFSGateway, cid))
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := solcMetadata{}
+	if err := json.Unmarshal(rawMetadata, &metadata); err != nil {
+		return nil, fmt.Errorf("could not decode the metadata %s: %v", cid, err)
+	}
+
+	result := &FetchResult{
+		Files:            map[FileName]*SourceCodeFile{},
+		CompilerVersion:  "v" + metadata.Compiler.Version,
+		EVMVersion:       metadata.Settings.EVMVersion,
+		OptimizationUsed: metadata.Settings.Optimizer.Enabled,
+		Runs:             metadata.Settings.Optimizer.Runs,
+		ViaIR:            metadata.Settings.ViaIR,
+		Libraries:        map[string]string{},
+		MetadataCID:      cid,
+	}
+	for _, name := range metadata.Settings.CompilationTarget {
+		result.ContractName = name
+	}
+	for name, address := range metadata.Settings.Libraries {
+		// libraries are indexed by "path:Library"
+		result.Libraries[name[strings.LastIndex(name, ":")+1:]] = strings.ToLower(address)
+	}
+
+	sourcePaths := make([]string, 0, len(metadata.Sources))
+	for sourcePath := range metadata.Sources {
+		sourcePaths = append(sourcePaths, sourcePath)
+	}
+	sort.Strings(sourcePaths)
+
+	metadataPaths := map[FileName]string{}
+	for _, sourcePath := range sourcePaths {
+		source := metadata.Sources[sourcePath]
+
+		name := path.Base(sourcePath)
+		if other, ok := metadataPaths[name]; ok {
+			return nil, fmt.Errorf("files %s and %s have the same name", other, sourcePath)
+		}
+		metadataPaths[name] = sourcePath
+
+		content := source.Content
+		if content == "" {
+			content, err = getIPFSSource(f, cfg.IPFSGateway, sourcePath, source.URLs)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		file := &SourceCodeFile{
+			Name:       name,
+			RawContent: content,
+			PathFields: learnedPathFields(path.Clean(strings.TrimPrefix(sourcePath, "/"))),
+			Confidence: confidenceAuthoritative,
+		}
+		fillDependenciesAndImports(file)
+		fillPragmaAndLicense(file)
+		result.Files[name] = file
+	}
+
+	fixImportExtensions(result.Files)
+
+	if len(result.Files) == 0 {
+		return nil, fmt.Errorf("the metadata %s does not have any source", cid)
+	}
+
+	return result, nil
+}
+
+// getIPFSSource downloads a source listed in the metadata from the first
+// of its URLs pinned in IPFS.
+func getIPFSSource(f *fetcher, gateway, sourcePath string, urls []string) (string, error) {
+	for _, u := range urls {
+		cid, found := strings.CutPrefix(u, "dweb:/ipfs/")
+		if !found {
+			continue
+		}
+
+		content, err := f.get(ipfsURL(gateway, cid))
+		if err != nil {
+			return "", err
+		}
+		return string(content), nil
+	}
+
+	return "", fmt.Errorf("source %s is not pinned in IPFS", sourcePath)
+}
+
+func ipfsURL(gateway, cid string) string {
+	return strings.TrimRight(gateway, "/") + "/ipfs/" + cid
+}
+
+// metadataCID returns the IPFS hash of the metadata file, from the CBOR
+// metadata section at the end of the bytecode, as a CIDv0.
+func metadataCID(bytecode []byte) (string, error) {
+	if len(bytecode) < 2 {
+		return "", errors.New("the contract does not have bytecode")
+	}
+
+	metadataLen := int(bytecode[len(bytecode)-2])<<8 | int(bytecode[len(bytecode)-1])
+	if metadataLen+2 > len(bytecode) {
+		return "", errors.New("the bytecode does not have a metadata section")
+	}
+	section := bytecode[len(bytecode)-2-metadataLen : len(bytecode)-2]
+
+	i := bytes.Index(section, ipfsMetadataKey)
+	if i < 0 || i+len(ipfsMetadataKey)+34 > len(section) {
+		return "", errors.New("the metadata section of the bytecode does not have an IPFS hash")
+	}
+	start := i + len(ipfsMetadataKey)
+
+	return base58Encode(section[start : start+34]), nil
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58Encode encodes the bytes with the bitcoin alphabet, used by IPFS.
+func base58Encode(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	base := big.NewInt(58)
+	mod := new(big.Int)
+
+	encoded := []byte{}
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		encoded = append(encoded, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		encoded = append(encoded, base58Alphabet[0])
+	}
+
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+
+	return string(encoded)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// pathsFileName is the file written with -save-paths, which -learned reads
+// back in later fetches of the same contract.
+const pathsFileName string = "paths.json"
+
+// savedPaths returns the path of each file with a complete path, relative
+// to the root of the tree, by name.
+func savedPaths(files map[FileName]*SourceCodeFile) map[FileName]string {
+	paths := map[FileName]string{}
+	for _, f := range files {
+		relPath, err := outputPath(f)
+		if err != nil {
+			continue
+		}
+		paths[f.Name] = relPath
+	}
+
+	return paths
+}
+
+func writePathsFile(fw FileWriter, paths map[FileName]string, dstPath string) error {
+	raw, err := json.MarshalIndent(paths, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode paths: %v", err)
+	}
+
+	if err := fw.MkdirAll(dstPath, 0750); err != nil {
+		return fmt.Errorf("could not create directory '%s': %v", dstPath, err)
+	}
+
+	pathsPath := path.Join(dstPath, pathsFileName)
+	if err := fw.WriteFile(pathsPath, append(raw, '\n'), 0640); err != nil {
+		return fmt.Errorf("could not save file %s: %v", pathsPath, err)
+	}
+
+	return nil
+}
+
+// readLearnedPaths reads a paths file, as written with -save-paths and
+// maybe corrected by hand, mapping the name of each file to its path
+// relative to the root of the tree.
+func readLearnedPaths(filePath string) (map[FileName]string, error) {
+	raw, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read paths file %s: %v", filePath, err)
+	}
+
+	learned := map[FileName]string{}
+	if err := json.Unmarshal(raw, &learned); err != nil {
+		return nil, fmt.Errorf("could not decode paths file %s: %v", filePath, err)
+	}
+
+	names := make([]FileName, 0, len(learned))
+	for name := range learned {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		relPath := path.Clean(learned[name])
+		if path.IsAbs(relPath) || relPath == ".." || strings.HasPrefix(relPath, "../") {
+			return nil, fmt.Errorf("paths file %s: path %s of %s is not inside the tree", filePath, learned[name], name)
+		}
+		if path.Base(relPath) != name {
+			return nil, fmt.Errorf("paths file %s: path %s does not end with the file name %s", filePath, learned[name], name)
+		}
+		learned[name] = relPath
+	}
+
+	return learned, nil
+}
+
+// learnedPathFields returns the path fields of a path read from a paths
+// file.
+func learnedPathFields(relPath string) []string {
+	pathFields := []string{rootDirName}
+	if dir := path.Dir(relPath); dir != "." {
+		pathFields = append(pathFields, strings.Split(dir, "/")...)
+	}
+	return pathFields
+}
@@ -1,48 +1,600 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
 )
 
+// command is a concode subcommand. run receives the command name and the
+// arguments after it, and returns the exit code.
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(name string, args []string) int
+
+	// aliases are other names the command is run with
+	aliases []string
+}
+
+const (
+	exitError      int = 1
+	exitWriteError int = 2
+)
+
+// defaultCommand is run when the first argument is not a command name, so
+// that "concode ADDRESS" is a shorthand for "concode fetch ADDRESS".
+const defaultCommand string = "fetch"
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{
+			name:        "fetch",
+			usage:       "[options] (CONTRACT_ADDRESS [CONTRACT_ADDRESS...] | -tx TX_HASH | -by-deployer ADDRESS)",
+			description: "save the source code files of the contracts",
+			run:         runFetch,
+		},
+		{
+			name:        "flatten",
+			usage:       "[options] CONTRACT_ADDRESS",
+			description: "print the source code of the contract as a single file",
+			run:         runFlatten,
+		},
+		{
+			name:        "graph",
+			usage:       "[options] CONTRACT_ADDRESS",
+			description: "print the dependencies between the files in DOT format",
+			run:         runGraph,
+		},
+		{
+			name:        "verify",
+			usage:       "[options] -bytecode FILE CONTRACT_ADDRESS",
+			description: "check that the deployed bytecode of the contract matches a compiled one",
+			run:         runVerify,
+			aliases:     []string{"compare"},
+		},
+		{
+			name:        "doctor",
+			usage:       "[options]",
+			description: "check the connectivity to the explorer, the API key and the cache directory",
+			run:         runDoctor,
+		},
+	}
+}
+
 func main() {
-	targetDir := flag.String("d", "./concode", "Directory where the files are saved")
-	importsBasePath := flag.String("b", "", "append base path to non relative imports")
+	args := os.Args[1:]
 
-	flag.Usage = func() {
-		fmt.Println("Usage: concode [options] CONTRACT_ADDRESS")
-		fmt.Println("Options:")
-		flag.PrintDefaults()
+	name := defaultCommand
+	if len(args) > 0 && lookupCommand(args[0]) != nil {
+		name = args[0]
+		args = args[1:]
 	}
 
-	flag.Parse()
+	cmd := lookupCommand(name)
+	os.Exit(cmd.run(cmd.name, args))
+}
+
+func lookupCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name || slices.Contains(commands[i].aliases, name) {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// parseFlags parses the command line flags of a command, with defaults
+// from the config file. It exits on invalid flags.
+func parseFlags(fs *flag.FlagSet, name string, args []string) {
+	cmd := lookupCommand(name)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: concode %s %s\n", cmd.name, cmd.usage)
+		fmt.Fprintf(fs.Output(), "\n%s\n\nCommands:\n", cmd.description)
+		for _, c := range commands {
+			fmt.Fprintf(fs.Output(), "  %-10s %s\n", c.name, c.description)
+		}
+		fmt.Fprintln(fs.Output(), "\nOptions:")
+		fs.PrintDefaults()
+	}
+
+	// without a config directory there is no config file to load
+	if configPath, err := configFilePath(); err == nil {
+		if err := loadConfigFile(fs, configPath); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// the flag set exits on invalid flags
+	_ = fs.Parse(args)
+}
+
+// sourceFlags are the flags that control how the source code of a contract
+// is fetched and its directory structure reconstructed. They are shared by
+// all the commands.
+type sourceFlags struct {
+	chainName       *string
+	chainID         *int
+	importsBasePath *string
+	remappings      remapFlag
+	cacheDir        *string
+	rps             *float64
+	pathStrategy    *string
+	maxBytes        *int64
+	timeout         *time.Duration
+	allowSimilar    *bool
+	printURL        *bool
+	contractName    *string
+	solcRemappings  *string
+	sourceSelector  *string
+	noNetwork       *bool
+	renderURL       *string
+	repo            *string
+	strict          *bool
+	apiKey          *string
+	importStyle     *string
+	learned         *string
+	maxDepth        *int
+	ipfs            *bool
+	ipfsGateway     *string
+	apiVersion      *string
+}
+
+func addSourceFlags(fs *flag.FlagSet) *sourceFlags {
+	sf := &sourceFlags{}
+	sf.chainName = fs.String("chain", "", "name of the chain where the contract is deployed (default "+defaultChain+")")
+	sf.chainID = fs.Int("chain-id", 0, "ID of the chain where the contract is deployed, alternative to -chain")
+	sf.importsBasePath = fs.String("b", "", "append base path to non relative imports")
+	fs.Var(&sf.remappings, "remap", "rewrite imports starting with PREFIX as PREFIX=REPLACEMENT, can be repeated and the first match wins")
+	sf.cacheDir = fs.String("cache-dir", "", "cache fetched pages in this directory and revalidate them on later runs")
+	sf.rps = fs.Float64("rps", 5, "maximum number of requests per second sent to the explorer, 0 disables the limit")
+	sf.pathStrategy = fs.String("path-strategy", pathStrategyLongest, "how to choose between the paths suggested by the files importing a file: longest or frequent")
+	sf.importStyle = fs.String("import-style", importStyleRoot, "how imports that are neither relative nor packages are resolved, from the project root (root) or from the importing file (relative); an accuracy knob for projects known to use one convention")
+	sf.learned = fs.String("learned", "", "paths file written by a previous fetch with -save-paths, maybe corrected by hand, whose paths are used instead of inferring them")
+	sf.maxDepth = fs.Int("max-depth", 32, "maximum number of directories of an inferred path, deeper paths from malformed imports are capped or ignored, 0 disables the limit")
+	sf.ipfs = fs.Bool("ipfs", false, "get the sources and their paths from the metadata file pinned in IPFS, whose hash is in the deployed bytecode, instead of the explorer page")
+	sf.ipfsGateway = fs.String("ipfs-gateway", defaultIPFSGateway, "IPFS gateway used with -ipfs")
+	sf.apiVersion = fs.String("api-version", apiVersionV2, "version of the explorer API: v2 (the unified Etherscan API, one key for every chain) or v1 (the API of the explorer of each chain)")
+	sf.maxBytes = fs.Int64("max-bytes", 50*1024*1024, "maximum size in bytes of a response from the explorer, 0 disables the limit")
+	sf.timeout = fs.Duration("timeout", time.Minute, "maximum duration of each request to the explorer, 0 disables the timeout")
+	sf.allowSimilar = fs.Bool("allow-similar", false, "if the contract is not verified, fetch the source of a similar contract reported by the explorer (an approximation, not the real source)")
+	sf.printURL = fs.Bool("print-url", false, "print the URL of each request to stderr")
+	sf.contractName = fs.String("contract-name", "", "name of the main contract, overrides the one shown by the explorer")
+	sf.solcRemappings = fs.String("solc-remappings", "", "file with the solc remappings of the project (one PREFIX=TARGET per line), used to place files imported by package imports")
+	sf.sourceSelector = fs.String("source-selector", os.Getenv("CONCODE_SOURCE_SELECTOR"), "attribute identifying the elements with source code in the explorer page, as ATTR=VALUE or a class name, in case the page layout changes (default from CONCODE_SOURCE_SELECTOR)")
+	sf.repo = fs.String("repo", "", "fetch the source code from a GitHub repository given as OWNER/REPO@COMMIT[/PREFIX] instead of the explorer, keeping the paths of the repository")
+	sf.strict = fs.Bool("strict", false, "fail if any path had to be guessed with placeholder directories or any import does not match a file")
+	sf.apiKey = fs.String("api-key", "", "key of the explorer API (default from ETHERSCAN_API_KEY)")
+	sf.renderURL = fs.String("render-url", "", "fetch the explorer pages through this rendering service, such as a local headless browser, which gets {\"url\": PAGE} in a POST request and returns the rendered HTML; for layouts built with JavaScript, -ipfs and -repo, which do not depend on the page, are preferred")
+	sf.noNetwork = fs.Bool("no-network", false, "never send requests, answer them from -cache-dir without revalidating and fail if they are not cached")
+	fs.BoolVar(&verbose, "v", false, "print progress information to stderr")
+
+	return sf
+}
+
+// config returns the configuration and the fetcher selected by the flags.
+func (sf *sourceFlags) config() (*config, *fetcher, error) {
+	c, err := lookupChain(*sf.chainName, *sf.chainID)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err = c.withAPIVersion(*sf.apiVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	solcRemappings := []remapping{}
+	if *sf.solcRemappings != "" {
+		solcRemappings, err = readRemappingsFile(*sf.solcRemappings)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var selector *sourceSelector
+	if *sf.sourceSelector != "" {
+		selector, err = parseSourceSelector(*sf.sourceSelector)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var learned map[FileName]string
+	if *sf.learned != "" {
+		learned, err = readLearnedPaths(*sf.learned)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if *sf.ipfs && *sf.repo != "" {
+		return nil, nil, errors.New("-ipfs and -repo can not be used together")
+	}
+
+	var repo *repoSource
+	if *sf.repo != "" {
+		repo, err = parseRepoSource(*sf.repo)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	cfg := &config{
+		Chain:           c,
+		Repo:            repo,
+		SolcRemappings:  solcRemappings,
+		LearnedPaths:    learned,
+		MaxDepth:        *sf.maxDepth,
+		IPFS:            *sf.ipfs,
+		IPFSGateway:     *sf.ipfsGateway,
+		SourceSelector:  selector,
+		ImportsBasePath: *sf.importsBasePath,
+		Remappings:      sf.remappings,
+		PathStrategy:    *sf.pathStrategy,
+		ImportStyle:     *sf.importStyle,
+		ContractName:    *sf.contractName,
+		AllowSimilar:    *sf.allowSimilar,
+		PrintURL:        *sf.printURL,
+		Strict:          *sf.strict,
+		APIKey:          *sf.apiKey,
+	}
+	if cfg.APIKey == "" {
+		// not the flag default, so that the key is not shown in the usage
+		cfg.APIKey = os.Getenv("ETHERSCAN_API_KEY")
+	}
+	warnRemappingOverlaps(cfg.Remappings)
+
+	f := newFetcher(fetcherOptions{
+		CacheDir:  *sf.cacheDir,
+		RPS:       *sf.rps,
+		MaxBytes:  *sf.maxBytes,
+		Timeout:   *sf.timeout,
+		NoNetwork: *sf.noNetwork,
+		RenderURL: *sf.renderURL,
+	})
+
+	return cfg, f, nil
+}
+
+func runFetch(name string, args []string) int {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	sf := addSourceFlags(fs)
+	targetDir := fs.String("d", "./concode", "Directory where the files are saved")
+	stripBOM := fs.Bool("strip-bom", false, "remove byte order marks, zero width and control characters before writing")
+	normalizeEOL := fs.Bool("normalize-eol", false, "rewrite the line endings of all files to the style (LF or CRLF) used by most of the lines")
+	onInvalidUTF8 := fs.String("on-invalid-utf8", invalidUTF8Keep, "what to do with files that are not valid UTF-8: keep, sanitize (replace invalid bytes) or error")
+	partial := fs.Bool("partial", false, "write files whose path could not be resolved into an _unresolved directory instead of failing")
+	absoluteImports := fs.Bool("absolute-imports", false, "rewrite the relative imports to the path of the imported file from the root of the tree, without ./ or ../")
+	provenance := fs.Bool("provenance", false, "add a comment at the top of each file recording where it was fetched from")
+	moduleRoot := fs.String("module-root", "", "subdirectory of the target directory where the reconstructed tree is written, imports are not changed")
+	rootName := fs.String("root-name", "", "name of the directory written in place of the root of the reconstructed tree, such as contracts, under -module-root if given")
+	flat := fs.Bool("flat", false, "write all files directly in the target directory, or in -module-root, renaming collisions and recording the original paths in flat-map.txt next to them")
+	chainSubdir := fs.Bool("chain-subdir", false, "save each contract in the <d>/<chain>/<address> directory, so that fetches from several chains do not collide")
+	writeWorkers := fs.Int("write-workers", 1, "number of files written concurrently, also used for -per-file-cmd")
+	perFileCommand := fs.String("per-file-cmd", "", "command run for each written file with its path as the last argument, e.g. to format it")
+	writeMetadataFile := fs.Bool("metadata", false, "write a metadata.json with the contract name, compiler version and settings, and a libraries.json with the addresses of the linked libraries")
+	standardJSON := fs.Bool("standard-json", false, "write an input.json with the solc standard JSON input reconstructed from the files and settings")
+	compactJSON := fs.Bool("compact-json", false, "write the standard JSON input minified instead of indented")
+	remixFile := fs.String("remix", "", "also save the files into this JSON file mapping each path to its content, which Remix imports as a workspace")
+	savePaths := fs.Bool("save-paths", false, "write a paths.json with the path of each file; once corrected, pass it to -learned in later fetches to reuse the corrections")
+	scaffoldExtras := fs.Bool("scaffold-extras", false, "write a .gitignore and an .editorconfig for Solidity and a foundry.toml with the compiler settings, to start a repository from the files")
+	writeIndexFile := fs.Bool("index", false, "write an INDEX.md listing every file with its path, pragma, license and imports")
+	metaOnly := fs.Bool("meta-only", false, "print the contract metadata as a JSON line and exit without writing the source code files")
+	ownOnly := fs.Bool("own-only", false, "write only the files imported with relative imports from the main contract, leaving out the dependencies imported as packages")
+	raw := fs.Bool("raw", false, "save the explorer page of the contract as received into page.html and exit without parsing it, to diagnose or archive")
+	excludePackages := fs.Bool("exclude-packages", false, "leave out the files whose path looks vendored, starting with @SCOPE, node_modules or lib")
+	listFunctions := fs.Bool("functions", false, "print the function and event signatures of the ABI of the contract, from the explorer API, and exit without writing")
+	listImports := fs.Bool("imports", false, "print the imports of each file as 'file: import' lines and exit without writing")
+	printTree := fs.Bool("tree", false, "print the reconstructed directory tree and exit without writing")
+	fetchRemote := fs.Bool("fetch-remote-imports", false, "download the files imported by URL into the remote directory")
+	printWrittenPaths := fs.Bool("print-written", false, "print the absolute path of each written source code file to stdout, one per line")
+	fetchCreation := fs.Bool("creation", false, "get the deployer and the creation transaction of the contract from the explorer API, saved in metadata.json with -metadata or printed to stderr")
+	fullProxy := fs.Bool("full-proxy", false, "fetch the proxy and the implementation contract reported by the explorer into the proxy and implementation directories, with a proxy-map.json")
+	sinkURL := fs.String("sink", "", "save the output into this storage instead of the -d directory, s3://BUCKET[/PREFIX] with the credentials and region in the AWS environment variables, needs a build with the s3 tag")
+	txHash := fs.String("tx", "", "fetch the contract created by this deployment transaction, found with the explorer API, instead of passing its address")
+	deployer := fs.String("by-deployer", "", "fetch every verified contract deployed by this address, found with the explorer API, each one into its own directory")
+	diamond := fs.Bool("diamond", false, "fetch an EIP-2535 diamond into the diamond directory and each facet listed by its loupe into facets/<address>, with the explorer API")
+	force := fs.Bool("force", false, "overwrite existing files without asking")
+	resume := fs.Bool("resume", false, "with several contracts, skip the ones completed by a previous run into the same directory")
+	hashSources := fs.Bool("source-hash", false, "compute a keccak256 hash of the sources of each contract, sorted by name and with the whitespace collapsed, and report the contracts with the same sources as one fetched before, in the -jsonl output or on stderr")
+	summary := fs.Bool("summary", false, "print to stderr a summary of each contract written: files, directories, entry file, compiler, license, package imports and files with placeholder directories")
+	timings := fs.Bool("timings", false, "print to stderr the time spent fetching, parsing, resolving the paths and writing the files")
+	jsonLines := fs.Bool("jsonl", false, "print the result of each contract as a JSON object per line")
+	parseFlags(fs, name, args)
+
+	contractAddresses := fs.Args()
+	sources := 0
+	for _, given := range []bool{len(contractAddresses) > 0, *txHash != "", *deployer != ""} {
+		if given {
+			sources++
+		}
+	}
+	if *targetDir == "" || sources != 1 {
+		fs.Usage()
+		return exitError
+	}
 
-	contractAddress := flag.Arg(0)
-	if *targetDir == "" || contractAddress == "" {
-		fmt.Fprintf(os.Stderr, "Usage: %s [-d TARGET_DIRECTORY] CONTRACT_ADDRESS\n", os.Args[0])
-		os.Exit(1)
+	for i, contractAddress := range contractAddresses {
+		address, err := normalizeAddress(contractAddress)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitError
+		}
+		contractAddresses[i] = address
+	}
+	if *deployer != "" {
+		address, err := normalizeAddress(*deployer)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitError
+		}
+		*deployer = address
 	}
 
-	files, err := getFiles(contractAddress)
+	cfg, f, err := sf.config()
 	if err != nil {
-		panic(err)
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+
+	if *txHash != "" {
+		contractAddress, err := getCreatedContract(f, cfg.Chain, cfg.APIKey, strings.TrimSpace(*txHash))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitError
+		}
+		infof("%s: created contract %s", *txHash, contractAddress)
+		contractAddresses = []string{contractAddress}
 	}
 
-	if err := fillPaths(files); err != nil {
-		panic(err)
+	if *deployer != "" {
+		contractAddresses, err = getDeployedContracts(f, cfg.Chain, cfg.APIKey, *deployer)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitError
+		}
+		if len(contractAddresses) == 0 {
+			fmt.Fprintf(os.Stderr, "error: %s did not deploy any contract\n", *deployer)
+			return exitError
+		}
+		infof("%s: deployed %d contracts", *deployer, len(contractAddresses))
+	}
+
+	cfg.StripBOM = *stripBOM
+	cfg.Partial = *partial
+	cfg.Provenance = *provenance
+	cfg.WriteIndex = *writeIndexFile
+	cfg.Force = *force
+	cfg.Flat = *flat
+	cfg.ListImports = *listImports
+	cfg.WriteWorkers = *writeWorkers
+	cfg.ModuleRoot = *moduleRoot
+	cfg.RootName = *rootName
+	cfg.WriteMetadata = *writeMetadataFile
+	cfg.InvalidUTF8 = *onInvalidUTF8
+	cfg.FetchRemote = *fetchRemote
+	cfg.MetaOnly = *metaOnly
+	cfg.NormalizeEOL = *normalizeEOL
+	cfg.OwnOnly = *ownOnly
+	cfg.StandardJSON = *standardJSON
+	cfg.CompactJSON = *compactJSON
+	cfg.PrintWritten = *printWrittenPaths
+	cfg.FetchCreation = *fetchCreation
+	cfg.PerFileCommand = *perFileCommand
+	cfg.FullProxy = *fullProxy
+	cfg.ListFunctions = *listFunctions
+	cfg.RemixFile = *remixFile
+	cfg.Raw = *raw
+	cfg.Diamond = *diamond
+	cfg.SavePaths = *savePaths
+	cfg.ExcludePackages = *excludePackages
+	cfg.ScaffoldExtras = *scaffoldExtras
+	cfg.Summary = *summary
+	cfg.AbsoluteImports = *absoluteImports
+	cfg.PrintTree = *printTree
+	if *hashSources {
+		cfg.SourceHashes = map[string]string{}
+	}
+	if *timings {
+		f.timings = newStageTimings()
+		defer f.timings.print(os.Stderr)
+	}
+
+	if *sinkURL != "" {
+		if *resume || *perFileCommand != "" || *printWrittenPaths {
+			fmt.Fprintln(os.Stderr, "error: -sink cannot be used with -resume, -per-file-cmd or -print-written, which need the files on disk")
+			return exitError
+		}
+
+		cfg.Sink, err = newSink(*sinkURL, *sf.timeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitError
+		}
+	}
+
+	// with -chain-subdir, the contracts of each chain are kept apart, each
+	// one in its own directory. A sink has its own prefix, so -d is not used
+	baseDir := *targetDir
+	if cfg.Sink != nil {
+		baseDir = ""
+	}
+	if *chainSubdir {
+		baseDir = path.Join(baseDir, cfg.Chain.Name)
 	}
 
-	if *importsBasePath != "" {
-		addBasePathToImports(files, *importsBasePath)
+	// batch runs record the completed contracts so that they can be resumed
+	batch := len(contractAddresses) > 1 || *deployer != ""
+	completed := map[string]bool{}
+	if batch && *resume {
+		completed, err = readCompleted(baseDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitError
+		}
 	}
 
-	writtenFiles, err := writeAllFiles(files, *targetDir)
+	// the first contract fetched with each source hash, to find duplicates
+	firstByHash := map[string]string{}
+
+	exitCode := 0
+	for _, contractAddress := range contractAddresses {
+		if completed[contractAddress] {
+			infof("%s: completed by a previous run, skipping it", contractAddress)
+			if *jsonLines {
+				line, err := json.Marshal(contractReport{Address: contractAddress, Chain: cfg.Chain.Name, Status: statusSkipped})
+				if err != nil {
+					panic(err)
+				}
+				fmt.Println(string(line))
+			}
+			continue
+		}
+
+		// with several contracts, each one is saved in its own directory
+		contractDir := baseDir
+		if batch || *chainSubdir {
+			contractDir = path.Join(baseDir, contractAddress)
+		}
+
+		writtenFiles, err := fetchContract(f, contractAddress, contractDir, cfg)
+		if err == nil && batch && cfg.Sink == nil {
+			err = markCompleted(baseDir, contractAddress)
+		}
+		if err != nil && *deployer != "" && errors.Is(err, errNotVerified) {
+			// the deployments are filtered to the verified contracts
+			infof("%s: not verified, skipping it", contractAddress)
+		} else if err != nil {
+			exitCode = max(exitCode, exitError)
+			if wErr := (*writeError)(nil); errors.As(err, &wErr) {
+				exitCode = exitWriteError
+			}
+
+			if !*jsonLines {
+				fmt.Fprintf(os.Stderr, "error: %s: %v\n", contractAddress, err)
+			}
+		}
+
+		report := newContractReport(cfg.Chain, contractAddress, writtenFiles, err)
+		if hash, ok := cfg.SourceHashes[contractAddress]; ok {
+			report.SourceHash = hash
+			if first, found := firstByHash[hash]; found {
+				report.DuplicateOf = first
+				if !*jsonLines {
+					fmt.Fprintf(os.Stderr, "%s: same sources as %s\n", contractAddress, first)
+				}
+			} else {
+				firstByHash[hash] = contractAddress
+			}
+		}
+
+		if *jsonLines {
+			line, err := json.Marshal(report)
+			if err != nil {
+				panic(err)
+			}
+			fmt.Println(string(line))
+		}
+	}
+
+	return exitCode
+}
+
+func runFlatten(name string, args []string) int {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	order := flattenOrderTopological
+	fs.Func("flatten-order", "order of the files: topological (every file after its imports) or etherscan (the order of the explorer page, as its own flattened source) (default topological)", func(value string) error {
+		if value != flattenOrderTopological && value != flattenOrderEtherscan {
+			return fmt.Errorf("unknown flatten order '%s'", value)
+		}
+		order = value
+		return nil
+	})
+
+	return runContractOutput(fs, name, args, func(result *Result) string {
+		return flattenFiles(result.Files, order)
+	})
+}
+
+func runGraph(name string, args []string) int {
+	return runContractOutput(flag.NewFlagSet(name, flag.ExitOnError), name, args, func(result *Result) string {
+		return dependencyGraph(result.Files)
+	})
+}
+
+// runContractOutput runs a command that loads one contract and saves the
+// output built from it into a file, or prints it to stdout. fs may have
+// the flags of the command already.
+func runContractOutput(fs *flag.FlagSet, name string, args []string, build func(result *Result) string) int {
+	sf := addSourceFlags(fs)
+	outputFile := fs.String("o", "", "file where the output is saved (default stdout)")
+	parseFlags(fs, name, args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitError
+	}
+	contractAddress, err := normalizeAddress(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+
+	cfg, f, err := sf.config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+
+	result, err := reconstruct(context.Background(), f, contractAddress, cfg)
 	if err != nil {
-		panic(err)
+		fmt.Fprintf(os.Stderr, "error: %s: %v\n", contractAddress, err)
+		return exitError
+	}
+
+	if err := writeOutput(*outputFile, build(result)); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+
+	return 0
+}
+
+// writeOutput saves the output into outputFile, or prints it to stdout if
+// outputFile is empty.
+func writeOutput(outputFile, output string) error {
+	if outputFile == "" {
+		_, err := fmt.Print(output)
+		return err
+	}
+
+	if err := os.WriteFile(outputFile, []byte(output), 0640); err != nil {
+		return fmt.Errorf("could not save file %s: %v", outputFile, err)
 	}
 
-	if writtenFiles != len(files) {
-		panic(fmt.Sprintf("%d out of %d were written", writtenFiles, len(files)))
+	return nil
+}
+
+// verbose enables the messages printed with infof
+var verbose bool
+
+func infof(format string, args ...any) {
+	if verbose {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
 	}
 }
+
+func warnf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "warning: "+format+"\n", args...)
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestLookupCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"fetch", "fetch"},
+		{"verify", "verify"},
+		{"compare", "verify"},
+		{"0x1111111111111111111111111111111111111111", ""},
+	}
+
+	for _, tt := range tests {
+		got := ""
+		if cmd := lookupCommand(tt.name); cmd != nil {
+			got = cmd.name
+		}
+		if got != tt.want {
+			t.Errorf("lookupCommand(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
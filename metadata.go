@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const metadataFileName string = "metadata.json"
+const librariesFileName string = "libraries.json"
+
+// contractMetadata is the contract level information saved next to the
+// source code files.
+type contractMetadata struct {
+	Address          string `json:"address"`
+	Chain            string `json:"chain"`
+	ContractName     string `json:"contract_name,omitempty"`
+	License          string `json:"license,omitempty"`
+	CompilerVersion  string `json:"compiler_version,omitempty"`
+	EVMVersion       string `json:"evm_version,omitempty"`
+	OptimizationUsed bool   `json:"optimization_used"`
+	Runs             int    `json:"runs,omitempty"`
+	ViaIR            bool   `json:"via_ir"`
+	Deployer         string `json:"deployer,omitempty"`
+	CreationTx       string `json:"creation_tx,omitempty"`
+
+	// Pragmas are the experimental and abicoder pragmas used by any file,
+	// which old compilers need to be enabled explicitly
+	Pragmas []string `json:"pragmas,omitempty"`
+
+	// Files are the names of the files in the order of the explorer page
+	Files []string `json:"files"`
+
+	// Confidence is the confidence of the path of each file, by name, to
+	// tell which paths to double-check
+	Confidence map[string]string `json:"confidence,omitempty"`
+}
+
+// newContractMetadata returns the metadata of the contract. The license is
+// taken from the entry file, if known.
+func newContractMetadata(c chain, contractAddress string, result *FetchResult, entry *SourceCodeFile) contractMetadata {
+	license := ""
+	if entry != nil {
+		license = entry.License
+	}
+
+	return contractMetadata{
+		Address:          contractAddress,
+		Chain:            c.Name,
+		ContractName:     result.ContractName,
+		License:          license,
+		CompilerVersion:  result.CompilerVersion,
+		EVMVersion:       result.EVMVersion,
+		OptimizationUsed: result.OptimizationUsed,
+		Runs:             result.Runs,
+		ViaIR:            result.ViaIR,
+		Pragmas:          otherPragmas(result.Files),
+		Files:            explorerOrder(result.Files),
+		Confidence:       pathConfidences(result.Files),
+	}
+}
+
+// pathConfidences returns the confidence of the path of each file, by
+// name, or nil if the paths are not known yet.
+func pathConfidences(files map[FileName]*SourceCodeFile) map[string]string {
+	var confidences map[string]string
+	for _, f := range files {
+		if f.Confidence == "" {
+			continue
+		}
+		if confidences == nil {
+			confidences = map[string]string{}
+		}
+		confidences[f.Name] = f.Confidence
+	}
+
+	return confidences
+}
+
+// otherPragmas returns the experimental and abicoder pragmas used by the
+// files, sorted.
+func otherPragmas(files map[FileName]*SourceCodeFile) []string {
+	pragmas := []string{}
+	for _, f := range files {
+		for _, pragma := range f.OtherPragmas {
+			if !slices.Contains(pragmas, pragma) {
+				pragmas = append(pragmas, pragma)
+			}
+		}
+	}
+	sort.Strings(pragmas)
+
+	return pragmas
+}
+
+// explorerOrder returns the names of the files sorted by their position
+// in the explorer page. Files without a position go last, by name.
+func explorerOrder(files map[FileName]*SourceCodeFile) []string {
+	sorted := make([]*SourceCodeFile, 0, len(files))
+	for _, f := range files {
+		sorted = append(sorted, f)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if (a.Index == 0) != (b.Index == 0) {
+			return b.Index == 0
+		}
+		if a.Index != b.Index {
+			return a.Index < b.Index
+		}
+		return a.Name < b.Name
+	})
+
+	names := make([]string, 0, len(sorted))
+	for _, f := range sorted {
+		names = append(names, f.Name)
+	}
+
+	return names
+}
+
+func writeMetadata(fw FileWriter, metadata contractMetadata, dstPath string) error {
+	raw, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode metadata: %v", err)
+	}
+
+	if err := fw.MkdirAll(dstPath, 0750); err != nil {
+		return fmt.Errorf("could not create directory '%s': %v", dstPath, err)
+	}
+
+	metadataPath := path.Join(dstPath, metadataFileName)
+	if err := fw.WriteFile(metadataPath, append(raw, '\n'), 0640); err != nil {
+		return fmt.Errorf("could not save file %s: %v", metadataPath, err)
+	}
+
+	return nil
+}
+
+// linkedLibraries returns the addresses of the libraries indexed by
+// "path:Library", the form used by solc for linking, where path is the file
+// declaring the library. Libraries not declared in any file are indexed by
+// their name alone.
+func linkedLibraries(result *FetchResult, files map[FileName]*SourceCodeFile) map[string]string {
+	declared := map[string]string{}
+	for _, f := range files {
+		filePath, err := outputPath(f)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(f.RawContent, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) > 1 && fields[0] == "library" {
+				declared[strings.TrimRight(fields[1], "{")] = filePath
+			}
+		}
+	}
+
+	libraries := map[string]string{}
+	for name, address := range result.Libraries {
+		key := name
+		if filePath, ok := declared[name]; ok {
+			key = filePath + ":" + name
+		}
+		libraries[key] = address
+	}
+
+	return libraries
+}
+
+func writeLibraries(fw FileWriter, libraries map[string]string, dstPath string) error {
+	raw, err := json.MarshalIndent(libraries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode libraries: %v", err)
+	}
+
+	if err := fw.MkdirAll(dstPath, 0750); err != nil {
+		return fmt.Errorf("could not create directory '%s': %v", dstPath, err)
+	}
+
+	librariesPath := path.Join(dstPath, librariesFileName)
+	if err := fw.WriteFile(librariesPath, append(raw, '\n'), 0640); err != nil {
+		return fmt.Errorf("could not save file %s: %v", librariesPath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the current output")
+
+// TestPipeline parses the saved explorer pages in testdata/pipeline, places
+// their files and compares the planned tree with the golden file next to
+// each page. Run with -update to rewrite the golden files.
+func TestPipeline(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join("testdata", "pipeline", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) == 0 {
+		t.Fatal("no pipeline fixtures")
+	}
+
+	for _, dir := range dirs {
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			page, err := os.Open(filepath.Join(dir, "page.html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer page.Close()
+
+			// pages parsed only in part keep the files read before the
+			// error, which is recorded in the golden file
+			result, parseErr := parseFiles(page, nil)
+			var pErr *partialParseError
+			if parseErr != nil && !errors.As(parseErr, &pErr) {
+				t.Fatal(parseErr)
+			}
+			if err := fillPaths(result.Files, pathOptions{Strategy: pathStrategyLongest, MaxDepth: 32}); err != nil {
+				t.Fatal(err)
+			}
+			plan, err := planFiles(result.Files)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := formatTree(result, plan, parseErr)
+			goldenPath := filepath.Join(dir, "tree.golden")
+			if *update {
+				if err := os.WriteFile(goldenPath, []byte(got), 0640); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("tree does not match %s, run go test -update to accept it:\n%s", goldenPath, got)
+			}
+		})
+	}
+}
+
+// formatTree prints the parse error, if any, the contract settings and the
+// planned files, sorted by path, in a form that is easy to review in a
+// diff.
+func formatTree(result *FetchResult, plan map[string]string, parseErr error) string {
+	sb := &strings.Builder{}
+	if parseErr != nil {
+		fmt.Fprintf(sb, "error: %v\n", parseErr)
+	}
+	fmt.Fprintf(sb, "contract: %s\n", valueOrNone(result.ContractName))
+	fmt.Fprintf(sb, "compiler: %s\n", valueOrNone(result.CompilerVersion))
+	fmt.Fprintf(sb, "optimization: %t, runs %d\n", result.OptimizationUsed, result.Runs)
+	fmt.Fprintf(sb, "evm version: %s\n", valueOrNone(result.EVMVersion))
+	if len(result.Settings) > 0 {
+		fmt.Fprintf(sb, "settings: %d bytes\n", len(result.Settings))
+	}
+
+	paths := make([]string, 0, len(plan))
+	for p := range plan {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		fmt.Fprintf(sb, "-- %s --\n%s", p, plan[p])
+		if !strings.HasSuffix(plan[p], "\n") {
+			sb.WriteString("\n")
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// runPerFileCommand runs the command once for each written file, with the
+// path of the file as its last argument. The command is split in fields,
+// it is not run through a shell. At most workers commands run at the same
+// time, and every failure is reported in the returned error.
+func runPerFileCommand(command string, written []string, workers int) error {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return errors.New("the per file command is empty")
+	}
+
+	pending := make(chan string)
+	mu := sync.Mutex{}
+	failures := []string{}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < max(workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for filePath := range pending {
+				cmd := exec.Command(args[0], append(args[1:], filePath)...)
+				output, err := cmd.CombinedOutput()
+				if err == nil {
+					continue
+				}
+
+				failure := fmt.Sprintf("%s: %v", filePath, err)
+				if out := strings.TrimSpace(string(output)); out != "" {
+					failure += ": " + out
+				}
+
+				mu.Lock()
+				failures = append(failures, failure)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, filePath := range written {
+		pending <- filePath
+	}
+	close(pending)
+	wg.Wait()
+
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return fmt.Errorf(
+			"command '%s' failed for %d out of %d files:\n  %s",
+			command,
+			len(failures),
+			len(written),
+			strings.Join(failures, "\n  "))
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+)
+
+const (
+	proxyMapFileName      string = "proxy-map.json"
+	proxyDirName          string = "proxy"
+	implementationDirName string = "implementation"
+)
+
+// proxyMap records which directory of a full proxy output holds each
+// contract.
+type proxyMap struct {
+	Proxy          proxyMapEntry `json:"proxy"`
+	Implementation proxyMapEntry `json:"implementation"`
+}
+
+type proxyMapEntry struct {
+	Address   string `json:"address"`
+	Dir       string `json:"dir"`
+	FileCount int    `json:"file_count"`
+}
+
+// fetchFullProxy writes the source code of a proxy and of the
+// implementation reported by the explorer into separate directories of
+// targetDir, together with a proxy map. It returns the number of source
+// code files written.
+func fetchFullProxy(f *fetcher, proxyAddress, targetDir string, cfg *config) (int, error) {
+	result, similarMatch, err := fetchSource(f, proxyAddress, cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	if result.Implementation == "" {
+		return 0, fmt.Errorf("the explorer does not report an implementation contract for %s", proxyAddress)
+	}
+	infof("%s: implementation contract at %s", proxyAddress, result.Implementation)
+
+	contractCfg := *cfg
+	contractCfg.FullProxy = false
+
+	// the files of the proxy are written from the page fetched above,
+	// unless another mode fetches the proxy in its own way
+	proxyDir := path.Join(targetDir, proxyDirName)
+	var proxyCount int
+	if loadsFiles(&contractCfg) {
+		if err := reconstructPaths(f, proxyAddress, result, &contractCfg); err != nil {
+			return 0, err
+		}
+		proxyCount, err = writeContract(f, proxyAddress, result, similarMatch, proxyDir, &contractCfg)
+	} else {
+		proxyCount, err = fetchContract(f, proxyAddress, proxyDir, &contractCfg)
+	}
+	if err != nil {
+		return proxyCount, err
+	}
+
+	implementationCount, err := fetchContract(f, result.Implementation, path.Join(targetDir, implementationDirName), &contractCfg)
+	if err != nil {
+		return proxyCount + implementationCount, fmt.Errorf("implementation %s: %w", result.Implementation, err)
+	}
+
+	pm := proxyMap{
+		Proxy:          proxyMapEntry{Address: proxyAddress, Dir: proxyDirName, FileCount: proxyCount},
+		Implementation: proxyMapEntry{Address: result.Implementation, Dir: implementationDirName, FileCount: implementationCount},
+	}
+	if err := writeProxyMap(cfg.fileWriter(), pm, targetDir); err != nil {
+		return proxyCount + implementationCount, &writeError{err}
+	}
+
+	return proxyCount + implementationCount, nil
+}
+
+func writeProxyMap(fw FileWriter, pm proxyMap, dstPath string) error {
+	raw, err := json.MarshalIndent(pm, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode proxy map: %v", err)
+	}
+
+	mapPath := path.Join(dstPath, proxyMapFileName)
+	if err := fw.WriteFile(mapPath, append(raw, '\n'), 0640); err != nil {
+		return fmt.Errorf("could not save file %s: %v", mapPath, err)
+	}
+
+	return nil
+}
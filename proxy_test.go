@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	testProxyAddress          = "0x5fbdb2315678afecb367f032d93f642f64180aa3"
+	testImplementationAddress = "0xe7f1725e7734ce288f8367e1bb143e90bb3f0512"
+)
+
+// contractPage returns an explorer page with a single source file, and a
+// link to the implementation contract if implementation is not empty.
+func contractPage(name, implementation string) string {
+	link := ""
+	if implementation != "" {
+		link = fmt.Sprintf(`<div>This contract may be a proxy contract. Implementation contract at <a href="/address/%s">%s</a></div>`, implementation, implementation)
+	}
+
+	return fmt.Sprintf(`<html><body>
+<span class="h6 fw-bold mb-0">%s</span>
+%s
+<div id="dividcode">
+  <span class="text-muted">File 1 of 1 : %s.sol</span>
+  <pre class="js-sourcecopyarea editor" id="editor1">contract %s {}</pre>
+</div>
+</body></html>`, name, link, name, name)
+}
+
+func TestFetchFullProxy(t *testing.T) {
+	requests := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		switch r.URL.Path {
+		case "/address/" + testProxyAddress:
+			_, _ = w.Write([]byte(contractPage("Proxy", testImplementationAddress)))
+		case "/address/" + testImplementationAddress:
+			_, _ = w.Write([]byte(contractPage("Token", "")))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	targetDir := t.TempDir()
+	cfg := &config{
+		Chain:        chain{Name: "test", ID: 1, ExplorerURL: srv.URL},
+		PathStrategy: pathStrategyLongest,
+		MaxDepth:     32,
+		Force:        true,
+		FullProxy:    true,
+	}
+
+	count, err := fetchFullProxy(newFetcher(fetcherOptions{}), testProxyAddress, targetDir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("count = %d, want 2", count)
+	}
+
+	for path, n := range requests {
+		if n != 1 {
+			t.Errorf("%s requested %d times, want once", path, n)
+		}
+	}
+
+	for _, file := range []string{"proxy/Proxy.sol", "implementation/Token.sol"} {
+		if _, err := os.Stat(filepath.Join(targetDir, file)); err != nil {
+			t.Errorf("%s not written: %v", file, err)
+		}
+	}
+
+	raw, err := os.ReadFile(filepath.Join(targetDir, proxyMapFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm := proxyMap{}
+	if err := json.Unmarshal(raw, &pm); err != nil {
+		t.Fatal(err)
+	}
+	if pm.Implementation.Address != testImplementationAddress || pm.Proxy.FileCount != 1 {
+		t.Errorf("proxy map = %+v", pm)
+	}
+}
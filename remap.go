@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// remapping replaces the From prefix of an import path with To.
+type remapping struct {
+	From string
+	To   string
+}
+
+func parseRemapping(rule string) (remapping, error) {
+	from, to, found := strings.Cut(rule, "=")
+	if !found || from == "" {
+		return remapping{}, fmt.Errorf("invalid remapping '%s', expected PREFIX=REPLACEMENT", rule)
+	}
+
+	return remapping{From: from, To: to}, nil
+}
+
+// readRemappingsFile reads solc remappings, one per line. Empty lines and
+// lines starting with # are skipped, and remapping contexts
+// (context:prefix=target) are ignored.
+func readRemappingsFile(filePath string) ([]remapping, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open remappings file %s: %v", filePath, err)
+	}
+	defer file.Close()
+
+	remappings := []remapping{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if context, rule, found := strings.Cut(line, ":"); found && !strings.Contains(context, "=") {
+			line = rule
+		}
+
+		rm, err := parseRemapping(line)
+		if err != nil {
+			return nil, fmt.Errorf("remappings file %s: %v", filePath, err)
+		}
+		remappings = append(remappings, rm)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read remappings file %s: %v", filePath, err)
+	}
+
+	return remappings, nil
+}
+
+// remapFlag collects the remappings passed with a repeatable flag.
+type remapFlag []remapping
+
+func (r *remapFlag) String() string {
+	rules := []string{}
+	for _, rm := range *r {
+		rules = append(rules, rm.From+"="+rm.To)
+	}
+	return strings.Join(rules, ",")
+}
+
+func (r *remapFlag) Set(rule string) error {
+	rm, err := parseRemapping(rule)
+	if err != nil {
+		return err
+	}
+
+	*r = append(*r, rm)
+	return nil
+}
+
+// warnRemappingOverlaps warns about remappings whose prefix is shadowed by
+// an earlier remapping, as only the first matching remapping is applied.
+func warnRemappingOverlaps(remappings []remapping) {
+	for i, later := range remappings {
+		for _, earlier := range remappings[:i] {
+			if strings.HasPrefix(later.From, earlier.From) {
+				warnf("remapping '%s=%s' overlaps with earlier remapping '%s=%s', the earlier one takes precedence",
+					later.From, later.To, earlier.From, earlier.To)
+				break
+			}
+		}
+	}
+}
+
+// applyRemappings returns the import path rewritten with the first
+// remapping whose prefix matches it.
+func applyRemappings(importPath string, remappings []remapping) (string, bool) {
+	for _, rm := range remappings {
+		if strings.HasPrefix(importPath, rm.From) {
+			return rm.To + strings.TrimPrefix(importPath, rm.From), true
+		}
+	}
+
+	return importPath, false
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+)
+
+// remixWorkspace returns the files as a JSON object mapping the path of
+// each file to its content, which Remix imports as a workspace. Files
+// without a complete path are placed in the unresolved directory.
+func remixWorkspace(files map[FileName]*SourceCodeFile) (string, error) {
+	workspace := map[string]string{}
+	for _, f := range files {
+		relPath, err := outputPath(f)
+		if err != nil {
+			relPath = path.Join(unresolvedDirName, f.Name)
+		}
+		workspace[relPath] = f.RawContent
+	}
+
+	raw, err := json.MarshalIndent(workspace, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("could not encode Remix workspace: %v", err)
+	}
+
+	return string(raw) + "\n", nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+const remoteDirName string = "remote"
+
+// isURLImport reports whether the import refers to a URL instead of a path,
+// like the GitHub imports supported by old compilers and Remix.
+func isURLImport(importPath string) bool {
+	return strings.Contains(importPath, "://") || strings.HasPrefix(importPath, "github.com/")
+}
+
+// remoteURLs returns the URL to download the raw content of a URL import
+// and the path, relative to the target directory, where it is saved.
+func remoteURLs(importPath string) (string, string, error) {
+	rawURL := importPath
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid remote import '%s': %v", importPath, err)
+	}
+
+	localPath := path.Join(remoteDirName, path.Clean("/"+u.Host+"/"+u.Path))
+
+	// GitHub page links are downloaded from the raw content host
+	if u.Host == "github.com" {
+		fields := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
+		if len(fields) > 4 && fields[2] == "blob" {
+			u.Host = "raw.githubusercontent.com"
+			u.Path = "/" + strings.Join(append(fields[:2], fields[3:]...), "/")
+		}
+	}
+
+	return u.String(), localPath, nil
+}
+
+// fetchRemoteImports downloads the URL imports of every file and writes
+// them into the remote directory. Imports of the downloaded files are not
+// followed.
+func fetchRemoteImports(fw FileWriter, f *fetcher, files map[FileName]*SourceCodeFile, dstPath string) error {
+	imports := map[string]bool{}
+	for _, file := range files {
+		for _, imp := range file.RemoteImports {
+			imports[imp] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(imports))
+	for imp := range imports {
+		sorted = append(sorted, imp)
+	}
+	sort.Strings(sorted)
+
+	for _, imp := range sorted {
+		downloadURL, localPath, err := remoteURLs(imp)
+		if err != nil {
+			return err
+		}
+
+		content, err := f.get(downloadURL)
+		if err != nil {
+			return fmt.Errorf("could not fetch remote import '%s': %v", imp, err)
+		}
+
+		filePath := path.Join(dstPath, localPath)
+		if err := fw.MkdirAll(path.Dir(filePath), 0750); err != nil {
+			return fmt.Errorf("could not create directory '%s': %v", path.Dir(filePath), err)
+		}
+		if err := fw.WriteFile(filePath, content, 0640); err != nil {
+			return fmt.Errorf("could not save file %s: %v", filePath, err)
+		}
+	}
+
+	return nil
+}
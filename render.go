@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// getPage returns the explorer page at url and the URL of the response
+// after following redirects. With a rendering service, the page is the HTML
+// rendered by the service, for layouts that build the sources with
+// JavaScript.
+func (f *fetcher) getPage(url string) ([]byte, string, error) {
+	if f.renderURL == "" {
+		return f.getFollowed(url)
+	}
+
+	body, err := f.render(url)
+	return body, url, err
+}
+
+// render asks the rendering service to load the page at url in a browser,
+// sending {"url": url} in a POST request, and returns the rendered HTML.
+// Rendered pages are not cached.
+func (f *fetcher) render(url string) ([]byte, error) {
+	defer f.timings.track(stageFetch, time.Now())
+
+	if f.noNetwork {
+		return nil, fmt.Errorf("%s can not be rendered, network access is disabled", url)
+	}
+
+	reqBody, err := json.Marshal(map[string]string{"url": url})
+	if err != nil {
+		return nil, fmt.Errorf("could not encode render request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(f.ctx, http.MethodPost, f.renderURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	f.limiter.wait()
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("render request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var bodyReader io.Reader = resp.Body
+	if f.maxBytes > 0 {
+		bodyReader = io.LimitReader(resp.Body, f.maxBytes+1)
+	}
+
+	body, err := io.ReadAll(bodyReader)
+	if err != nil {
+		return nil, fmt.Errorf("could not read response body: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the rendering service returned status %d for %s", resp.StatusCode, url)
+	}
+
+	if f.maxBytes > 0 && int64(len(body)) > f.maxBytes {
+		return nil, fmt.Errorf("rendered page of %s is larger than %d bytes", url, f.maxBytes)
+	}
+
+	return body, nil
+}
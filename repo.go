@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	githubAPIURL string = "https://api.github.com"
+	githubRawURL string = "https://raw.githubusercontent.com"
+)
+
+// repoSource identifies the source code of a contract published in a
+// GitHub repository, as referenced by the explorer for contracts verified
+// from a repository.
+type repoSource struct {
+	Repo   string
+	Commit string
+
+	// Prefix is the directory of the repository with the sources, empty
+	// for the whole repository
+	Prefix string
+}
+
+// parseRepoSource parses a repository reference as OWNER/REPO@COMMIT, with
+// an optional /PREFIX after the commit.
+func parseRepoSource(ref string) (*repoSource, error) {
+	repo, rest, found := strings.Cut(ref, "@")
+	if !found || strings.Count(repo, "/") != 1 || strings.HasPrefix(repo, "/") || strings.HasSuffix(repo, "/") {
+		return nil, fmt.Errorf("invalid repository '%s', expected OWNER/REPO@COMMIT[/PREFIX]", ref)
+	}
+
+	commit, prefix, _ := strings.Cut(rest, "/")
+	if commit == "" {
+		return nil, fmt.Errorf("invalid repository '%s', the commit is missing", ref)
+	}
+
+	return &repoSource{
+		Repo:   repo,
+		Commit: commit,
+		Prefix: strings.Trim(prefix, "/"),
+	}, nil
+}
+
+type githubTree struct {
+	Tree []struct {
+		Path string `json:"path"`
+		Type string `json:"type"`
+	} `json:"tree"`
+	Truncated bool `json:"truncated"`
+}
+
+// getRepoFiles downloads the Solidity files under the prefix of the
+// repository. Their paths in the repository are authoritative, so they are
+// not inferred from the imports.
+func getRepoFiles(f *fetcher, src *repoSource) (*FetchResult, error) {
+	treeURL := fmt.Sprintf("%s/repos/%s/git/trees/%s?recursive=1", githubAPIURL, src.Repo, src.Commit)
+	rawTree, err := f.get(treeURL)
+	if err != nil {
+		return nil, fmt.Errorf("could not list the tree of %s at %s: %v", src.Repo, src.Commit, githubError(err))
+	}
+
+	tree := githubTree{}
+	if err := json.Unmarshal(rawTree, &tree); err != nil {
+		return nil, fmt.Errorf("could not decode the tree of %s at %s: %v", src.Repo, src.Commit, err)
+	}
+	if tree.Truncated {
+		return nil, fmt.Errorf("the tree of %s at %s is too large to be listed, use a narrower prefix", src.Repo, src.Commit)
+	}
+
+	files := map[FileName]*SourceCodeFile{}
+	result := &FetchResult{Files: files, Libraries: map[string]string{}}
+	repoPaths := map[FileName]string{}
+	for _, entry := range tree.Tree {
+		if entry.Type != "blob" || path.Ext(entry.Path) != ".sol" {
+			continue
+		}
+
+		relPath := entry.Path
+		if src.Prefix != "" {
+			var found bool
+			relPath, found = strings.CutPrefix(entry.Path, src.Prefix+"/")
+			if !found {
+				continue
+			}
+		}
+
+		name := path.Base(relPath)
+		if other, ok := repoPaths[name]; ok {
+			return nil, fmt.Errorf("files %s and %s have the same name, use a narrower prefix", other, entry.Path)
+		}
+		repoPaths[name] = entry.Path
+
+		content, err := f.get(fmt.Sprintf("%s/%s/%s/%s", githubRawURL, src.Repo, src.Commit, entry.Path))
+		if err != nil {
+			return nil, fmt.Errorf("could not download %s: %v", entry.Path, githubError(err))
+		}
+
+		pathFields := []string{rootDirName}
+		if dir := path.Dir(relPath); dir != "." {
+			pathFields = append(pathFields, strings.Split(dir, "/")...)
+		}
+
+		file := &SourceCodeFile{
+			Name:       name,
+			RawContent: string(content),
+			PathFields: pathFields,
+			Confidence: confidenceAuthoritative,
+		}
+		fillDependenciesAndImports(file)
+		fillPragmaAndLicense(file)
+		files[name] = file
+	}
+
+	fixImportExtensions(files)
+
+	if len(files) == 0 {
+		return nil, errors.New("the repository does not have Solidity files under the prefix")
+	}
+
+	return result, nil
+}
+
+// githubError adds to the error of a GitHub request the message of the
+// response, such as "Not Found" for a missing repository or the rate limit
+// explanation of a 403.
+func githubError(err error) error {
+	var statusErr *httpStatusError
+	if !errors.As(err, &statusErr) {
+		return err
+	}
+
+	apiErr := struct {
+		Message string `json:"message"`
+	}{}
+	message := strings.TrimSpace(string(statusErr.Body))
+	if json.Unmarshal(statusErr.Body, &apiErr) == nil {
+		message = apiErr.Message
+	}
+	if message == "" {
+		return err
+	}
+
+	return fmt.Errorf("%v: %s", err, message)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGithubError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/owner/missing/git/trees/abc":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"Not Found","documentation_url":"https://docs.github.com/rest"}`))
+		case "/repos/owner/limited/git/trees/abc":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"message":"API rate limit exceeded for 127.0.0.1."}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("404: Not Found"))
+		}
+	}))
+	defer srv.Close()
+
+	f := newFetcher(fetcherOptions{})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/repos/owner/missing/git/trees/abc", "404 Not Found: Not Found"},
+		{"/repos/owner/limited/git/trees/abc", "403 Forbidden: API rate limit exceeded"},
+		{"/owner/repo/abc/src/Missing.sol", "404 Not Found: 404: Not Found"},
+	}
+
+	for _, tt := range tests {
+		_, err := f.get(srv.URL + tt.path)
+		if err == nil {
+			t.Fatalf("get(%s) did not fail", tt.path)
+		}
+		if got := githubError(err).Error(); !strings.Contains(got, tt.want) {
+			t.Errorf("githubError() = %q, want it to contain %q", got, tt.want)
+		}
+	}
+}
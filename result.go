@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Result is everything known about a reconstructed contract, in one value,
+// for the commands that print it instead of writing the files.
+type Result struct {
+	Address string
+
+	// SimilarMatch is the address of the contract whose source was used
+	// because Address is not verified, empty if not used
+	SimilarMatch string
+
+	Files map[FileName]*SourceCodeFile
+
+	// Entry is the file of the main contract, nil if unknown
+	Entry *SourceCodeFile
+
+	// Metadata holds the compiler, license and optimization settings
+	Metadata contractMetadata
+
+	// Unresolved are the imports of files that are not in the bundle, as
+	// "file: import"
+	Unresolved []string
+
+	// Cycles are the groups of files that import each other, directly or
+	// indirectly, each one sorted by name
+	Cycles [][]FileName
+}
+
+// reconstruct fetches the source code of a contract and reconstructs its
+// directory structure, without writing anything. Cancelling ctx interrupts
+// the requests in flight, and reconstruct then returns the error of ctx.
+func reconstruct(ctx context.Context, f *fetcher, contractAddress string, cfg *config) (*Result, error) {
+	fetched, similarMatch, err := loadContract(f.withContext(ctx), contractAddress, cfg)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := entryFile(fetched, cfg.ContractName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		Address:      contractAddress,
+		SimilarMatch: similarMatch,
+		Files:        fetched.Files,
+		Entry:        entry,
+		Metadata:     newContractMetadata(cfg.Chain, contractAddress, fetched, entry),
+		Unresolved:   unresolvedImports(fetched.Files),
+		Cycles:       importCycles(fetched.Files),
+	}, nil
+}
+
+// unresolvedImports returns the imports of files that are not in the
+// bundle, as "file: import", sorted.
+func unresolvedImports(files map[FileName]*SourceCodeFile) []string {
+	unresolved := []string{}
+	for _, f := range files {
+		for _, imp := range f.Imports {
+			if _, err := resolveImport(f, imp, files); err != nil {
+				unresolved = append(unresolved, fmt.Sprintf("%s: %s", f.Name, imp))
+			}
+		}
+	}
+	sort.Strings(unresolved)
+
+	return unresolved
+}
+
+// importCycles returns the strongly connected components of the import
+// graph with more than one file, found with Tarjan's algorithm.
+func importCycles(files map[FileName]*SourceCodeFile) [][]FileName {
+	names := make([]FileName, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	index := map[FileName]int{}
+	lowLink := map[FileName]int{}
+	onStack := map[FileName]bool{}
+	stack := []FileName{}
+	cycles := [][]FileName{}
+
+	var visit func(name FileName)
+	visit = func(name FileName) {
+		index[name] = len(index)
+		lowLink[name] = index[name]
+		stack = append(stack, name)
+		onStack[name] = true
+
+		for _, dependency := range files[name].Dependencies {
+			if _, ok := files[dependency]; !ok {
+				continue
+			}
+			if _, seen := index[dependency]; !seen {
+				visit(dependency)
+				lowLink[name] = min(lowLink[name], lowLink[dependency])
+			} else if onStack[dependency] {
+				lowLink[name] = min(lowLink[name], index[dependency])
+			}
+		}
+
+		if lowLink[name] != index[name] {
+			return
+		}
+
+		component := []FileName{}
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == name {
+				break
+			}
+		}
+		if len(component) > 1 {
+			sort.Strings(component)
+			cycles = append(cycles, component)
+		}
+	}
+
+	for _, name := range names {
+		if _, seen := index[name]; !seen {
+			visit(name)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+
+	return cycles
+}
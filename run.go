@@ -0,0 +1,824 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+var errNotVerified = errors.New("contract source code is not verified")
+
+// writeError is an error saving the files of a contract.
+type writeError struct {
+	err error
+}
+
+func (e *writeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *writeError) Unwrap() error {
+	return e.err
+}
+
+// config holds the options that apply to every fetched contract.
+type config struct {
+	Chain           chain
+	ImportsBasePath string
+	Remappings      []remapping
+	SolcRemappings  []remapping
+	LearnedPaths    map[FileName]string
+	MaxDepth        int
+	IPFS            bool
+	Summary         bool
+	AbsoluteImports bool
+	PrintTree       bool
+	IPFSGateway     string
+	SourceSelector  *sourceSelector
+	Repo            *repoSource
+	PathStrategy    string
+	ContractName    string
+	AllowSimilar    bool
+	StripBOM        bool
+	Partial         bool
+	Provenance      bool
+	WriteIndex      bool
+	Force           bool
+	Flat            bool
+	ListImports     bool
+	WriteWorkers    int
+	PrintURL        bool
+	ModuleRoot      string
+	RootName        string
+	WriteMetadata   bool
+	InvalidUTF8     string
+	FetchRemote     bool
+	MetaOnly        bool
+	NormalizeEOL    bool
+	OwnOnly         bool
+	StandardJSON    bool
+	CompactJSON     bool
+	PrintWritten    bool
+	APIKey          string
+	FetchCreation   bool
+	Strict          bool
+	PerFileCommand  string
+	FullProxy       bool
+	ListFunctions   bool
+	RemixFile       string
+	ImportStyle     string
+	Raw             bool
+	Diamond         bool
+	SavePaths       bool
+	ExcludePackages bool
+	ScaffoldExtras  bool
+
+	// SourceHashes gets the source hash of each loaded contract, by
+	// address, when not nil
+	SourceHashes map[string]string
+
+	// Sink is where the output is saved instead of the local disk, nil
+	// for the local disk.
+	Sink FileWriter
+}
+
+// fileWriter returns the FileWriter used to save the output.
+func (cfg *config) fileWriter() FileWriter {
+	if cfg.Sink != nil {
+		return cfg.Sink
+	}
+	return osFileWriter{}
+}
+
+// contractURL returns the URL of the explorer page of the contract, and
+// prints it if requested.
+func (cfg *config) contractURL(contractAddress string) string {
+	url := cfg.Chain.addressURL(contractAddress)
+	if cfg.PrintURL {
+		fmt.Fprintln(os.Stderr, url)
+	}
+
+	return url
+}
+
+// contractReport is the outcome of fetching one contract.
+type contractReport struct {
+	Address   string `json:"address"`
+	Chain     string `json:"chain"`
+	Status    string `json:"status"`
+	FileCount int    `json:"file_count"`
+	Error     string `json:"error,omitempty"`
+
+	// SourceHash is the hash of the normalized sources, with -source-hash
+	SourceHash string `json:"source_hash,omitempty"`
+
+	// DuplicateOf is the first contract of the run with the same source
+	// hash, if any
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+}
+
+const (
+	statusOK          string = "ok"
+	statusNotVerified string = "not_verified"
+	statusError       string = "error"
+	statusSkipped     string = "skipped"
+)
+
+func newContractReport(c chain, contractAddress string, fileCount int, err error) contractReport {
+	report := contractReport{
+		Address:   contractAddress,
+		Chain:     c.Name,
+		Status:    statusOK,
+		FileCount: fileCount,
+	}
+
+	if err != nil {
+		report.Status = statusError
+		if errors.Is(err, errNotVerified) {
+			report.Status = statusNotVerified
+		}
+		report.Error = err.Error()
+	}
+
+	return report
+}
+
+// completedFileName is the file in the target directory of a batch run
+// that lists the contracts written completely, one address per line.
+const completedFileName string = ".concode-completed"
+
+// readCompleted returns the addresses listed in the completed file of
+// targetDir. A missing file means that no contract was completed.
+func readCompleted(targetDir string) (map[string]bool, error) {
+	completedPath := path.Join(targetDir, completedFileName)
+	raw, err := os.ReadFile(completedPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]bool{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read file %s: %v", completedPath, err)
+	}
+
+	completed := map[string]bool{}
+	for _, line := range strings.Split(string(raw), "\n") {
+		if address := strings.TrimSpace(line); address != "" {
+			completed[address] = true
+		}
+	}
+
+	return completed, nil
+}
+
+// markCompleted appends the address to the completed file of targetDir.
+func markCompleted(targetDir, contractAddress string) error {
+	if err := os.MkdirAll(targetDir, 0750); err != nil {
+		return fmt.Errorf("could not create directory '%s': %v", targetDir, err)
+	}
+
+	completedPath := path.Join(targetDir, completedFileName)
+	file, err := os.OpenFile(completedPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return fmt.Errorf("could not open file %s: %v", completedPath, err)
+	}
+	defer file.Close()
+
+	if _, err := fmt.Fprintln(file, contractAddress); err != nil {
+		return fmt.Errorf("could not write file %s: %v", completedPath, err)
+	}
+
+	return nil
+}
+
+// loadContract fetches the source code of a contract and reconstructs its
+// directory structure. If the contract is not verified and a similar match
+// is used instead, its address is returned too.
+func loadContract(f *fetcher, contractAddress string, cfg *config) (*FetchResult, string, error) {
+	result, similarMatch, err := fetchSource(f, contractAddress, cfg)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := reconstructPaths(f, contractAddress, result, cfg); err != nil {
+		return nil, "", err
+	}
+
+	return result, similarMatch, nil
+}
+
+// reconstructPaths fills the paths of the files of a fetched contract, and
+// checks them with -strict.
+func reconstructPaths(f *fetcher, contractAddress string, result *FetchResult, cfg *config) error {
+	// the paths of the files of a repository or of the metadata are
+	// already known
+	if cfg.Repo == nil && !cfg.IPFS {
+		start := time.Now()
+		err := fillPaths(result.Files, pathOptions{
+			Strategy:    cfg.PathStrategy,
+			Remappings:  cfg.SolcRemappings,
+			ImportStyle: cfg.ImportStyle,
+			Learned:     cfg.LearnedPaths,
+			MaxDepth:    cfg.MaxDepth,
+		})
+		f.timings.track(stagePaths, start)
+		if err != nil {
+			return err
+		}
+	}
+
+	if verbose {
+		logConfidences(contractAddress, result.Files)
+	}
+
+	if cfg.Strict {
+		if problems := ambiguities(result.Files); len(problems) > 0 {
+			return fmt.Errorf("the reconstruction is ambiguous:\n  %s", strings.Join(problems, "\n  "))
+		}
+	}
+
+	return nil
+}
+
+// confidenceColors are the terminal colors of the path confidences.
+var confidenceColors = map[string]string{
+	confidenceAuthoritative: "\033[32m",
+	confidenceInferred:      "\033[36m",
+	confidenceGuessed:       "\033[33m",
+}
+
+// logConfidences prints the path of each file with its confidence, colored
+// if stderr is a terminal.
+func logConfidences(contractAddress string, files map[FileName]*SourceCodeFile) {
+	color := isTerminal(os.Stderr)
+	names := make([]FileName, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := files[name]
+		relPath, err := outputPath(f)
+		if err != nil {
+			relPath = f.Name
+		}
+
+		confidence := f.Confidence
+		if color && confidenceColors[confidence] != "" {
+			confidence = confidenceColors[confidence] + confidence + "\033[0m"
+		}
+		infof("%s: %s: %s", contractAddress, relPath, confidence)
+	}
+}
+
+// ambiguities describes the guesses made reconstructing the files: paths
+// that are incomplete or have placeholder directories, and imports of files
+// that are not in the bundle.
+func ambiguities(files map[FileName]*SourceCodeFile) []string {
+	problems := []string{}
+	for _, f := range files {
+		if _, err := outputPath(f); err != nil {
+			problems = append(problems, err.Error())
+		} else if slices.Contains(f.PathFields, placeholderDirName) {
+			problems = append(problems, fmt.Sprintf("file %s has placeholder directories in its path: %s", f.Name, strings.Join(f.PathFields[1:], "/")))
+		}
+
+		for _, imp := range f.Imports {
+			if _, err := resolveImport(f, imp, files); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	}
+	sort.Strings(problems)
+
+	return problems
+}
+
+// fetchSource fetches the source code of a contract, falling back to a
+// similar match if allowed. If a repository is configured, the source code
+// is fetched from it instead of the explorer, and with IPFS it is fetched
+// from the metadata pinned there.
+func fetchSource(f *fetcher, contractAddress string, cfg *config) (*FetchResult, string, error) {
+	if cfg.Repo != nil {
+		result, err := getRepoFiles(f, cfg.Repo)
+		if err != nil {
+			return nil, "", err
+		}
+		infof("%s: %d files from %s at %s", contractAddress, len(result.Files), cfg.Repo.Repo, cfg.Repo.Commit)
+
+		return result, "", nil
+	}
+
+	if cfg.IPFS {
+		result, err := getIPFSFiles(f, contractAddress, cfg)
+		if err != nil {
+			return nil, "", err
+		}
+		infof("%s: %d files from the metadata in IPFS", contractAddress, len(result.Files))
+
+		return result, "", nil
+	}
+
+	result, err := getFiles(f, cfg.contractURL(contractAddress), cfg.SourceSelector)
+	if err = allowPartialParse(contractAddress, err, cfg); err != nil {
+		return nil, "", err
+	}
+
+	similarMatch := ""
+	if len(result.Files) == 0 && cfg.AllowSimilar && result.SimilarMatch != "" {
+		similarMatch = result.SimilarMatch
+		warnf("contract %s is not verified, using the source of similar contract %s. It is an approximation, not the real source", contractAddress, similarMatch)
+
+		result, err = getFiles(f, cfg.contractURL(similarMatch), cfg.SourceSelector)
+		if err = allowPartialParse(similarMatch, err, cfg); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if len(result.Files) == 0 {
+		return nil, "", errNotVerified
+	}
+
+	infof("%s: %d files, compiler %s, evm version %s, optimization %t with %d runs",
+		contractAddress, len(result.Files), valueOrNone(result.CompilerVersion), valueOrNone(result.EVMVersion),
+		result.OptimizationUsed, result.Runs)
+
+	return result, similarMatch, nil
+}
+
+// provenance describes the source the files of the contract were read
+// from, for the comment written at the top of each file.
+func provenance(result *FetchResult, contractAddress, similarMatch string, cfg *config) string {
+	switch {
+	case cfg.Repo != nil:
+		return fmt.Sprintf("repo https://github.com/%s@%s", cfg.Repo.Repo, cfg.Repo.Commit)
+	case result.MetadataCID != "":
+		return fmt.Sprintf("ipfs %s", result.MetadataCID)
+	case similarMatch != "":
+		return fmt.Sprintf("etherscan %s %s (similar match for %s)", cfg.Chain.Name, similarMatch, contractAddress)
+	}
+	return fmt.Sprintf("etherscan %s %s", cfg.Chain.Name, contractAddress)
+}
+
+// allowPartialParse returns err, unless it is a page parsed only in part
+// and -partial is set, which only warns about it so that the files read
+// are used.
+func allowPartialParse(contractAddress string, err error, cfg *config) error {
+	var pErr *partialParseError
+	if cfg.Partial && errors.As(err, &pErr) {
+		warnf("%s: %v, the last one may be incomplete", contractAddress, err)
+		return nil
+	}
+	return err
+}
+
+// fetchContract fetches the source code of a contract, reconstructs its
+// directory structure and writes it into targetDir. It returns the number
+// of files written.
+func fetchContract(f *fetcher, contractAddress, targetDir string, cfg *config) (int, error) {
+	if cfg.FullProxy {
+		return fetchFullProxy(f, contractAddress, targetDir, cfg)
+	}
+
+	if cfg.Diamond {
+		return fetchDiamond(f, contractAddress, targetDir, cfg)
+	}
+
+	if cfg.Raw {
+		return 0, fetchRaw(f, contractAddress, targetDir, cfg)
+	}
+
+	if cfg.ListFunctions {
+		return 0, printFunctions(os.Stdout, f, contractAddress, cfg)
+	}
+
+	if cfg.MetaOnly {
+		return 0, fetchMetadataOnly(f, contractAddress, targetDir, cfg)
+	}
+
+	result, similarMatch, err := loadContract(f, contractAddress, cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	return writeContract(f, contractAddress, result, similarMatch, targetDir, cfg)
+}
+
+// loadsFiles reports whether fetchContract loads the files of the contract
+// and writes them, instead of running one of the modes that fetch it in
+// another way.
+func loadsFiles(cfg *config) bool {
+	return !cfg.FullProxy && !cfg.Diamond && !cfg.Raw && !cfg.ListFunctions && !cfg.MetaOnly
+}
+
+// writeContract writes the files of a loaded contract into targetDir,
+// together with the outputs enabled in cfg. It returns the number of files
+// written.
+func writeContract(f *fetcher, contractAddress string, result *FetchResult, similarMatch, targetDir string, cfg *config) (int, error) {
+	files := result.Files
+
+	if cfg.SourceHashes != nil {
+		cfg.SourceHashes[contractAddress] = sourceHash(files)
+	}
+
+	if cfg.ListImports {
+		printImports(os.Stdout, files)
+		return 0, nil
+	}
+
+	if cfg.PrintTree {
+		fmt.Print(buildTree(files))
+		return 0, nil
+	}
+
+	entry, err := entryFile(result, cfg.ContractName)
+	if err != nil {
+		return 0, err
+	}
+
+	if cfg.OwnOnly {
+		if entry == nil {
+			return 0, errors.New("the main contract is unknown, set it with -contract-name to keep only its own sources")
+		}
+		files = ownFiles(files, entry)
+		infof("%s: keeping %d of %d files imported relatively from %s", contractAddress, len(files), len(result.Files), entry.Name)
+	}
+
+	if cfg.ExcludePackages {
+		kept := nonPackageFiles(files)
+		infof("%s: leaving out %d of %d files under package directories", contractAddress, len(files)-len(kept), len(files))
+		files = kept
+	}
+
+	if !cfg.Flat && len(files) > 0 && !anyPathResolved(files) {
+		if !cfg.Partial {
+			return 0, errNoPathResolved
+		}
+		warnf("%s: %v", contractAddress, errNoPathResolved)
+	}
+
+	// relative imports are made absolute first, so that the base path is
+	// prepended to them too
+	if cfg.AbsoluteImports {
+		makeImportsAbsolute(files)
+	}
+
+	if cfg.ImportsBasePath != "" || len(cfg.Remappings) > 0 {
+		addBasePathToImports(files, cfg.ImportsBasePath, cfg.Remappings)
+	}
+
+	provenanceComment := ""
+	if cfg.Provenance {
+		provenanceComment = provenance(result, contractAddress, similarMatch, cfg)
+	}
+
+	fw := cfg.fileWriter()
+	wOpts := writeOptions{
+		StripBOM:     cfg.StripBOM,
+		Partial:      cfg.Partial,
+		Provenance:   provenanceComment,
+		Flat:         cfg.Flat,
+		Workers:      cfg.WriteWorkers,
+		ModuleRoot:   cfg.ModuleRoot,
+		RootName:     cfg.RootName,
+		InvalidUTF8:  cfg.InvalidUTF8,
+		NormalizeEOL: cfg.NormalizeEOL,
+	}
+
+	// the files of a sink are not checked, they are always overwritten
+	if !cfg.Force && cfg.Sink == nil {
+		if err := confirmOverwrite(existingFiles(files, targetDir, wOpts)); err != nil {
+			return 0, err
+		}
+	}
+
+	writeStart := time.Now()
+	written, err := writeAllFiles(fw, files, targetDir, wOpts)
+	f.timings.track(stageWrite, writeStart)
+	writtenFiles := len(written)
+	if err != nil {
+		return writtenFiles, &writeError{err}
+	}
+
+	if writtenFiles != len(files) {
+		return writtenFiles, &writeError{fmt.Errorf(
+			"%d out of %d files were written, not written: %s",
+			writtenFiles,
+			len(files),
+			strings.Join(unwrittenFiles(files, written, targetDir, wOpts), ", "))}
+	}
+
+	if cfg.PerFileCommand != "" {
+		if err := runPerFileCommand(cfg.PerFileCommand, written, cfg.WriteWorkers); err != nil {
+			return writtenFiles, err
+		}
+	}
+
+	if cfg.PrintWritten {
+		if err := printWritten(os.Stdout, written); err != nil {
+			return writtenFiles, err
+		}
+	}
+
+	if cfg.FetchRemote {
+		if err := fetchRemoteImports(fw, f, files, targetDir); err != nil {
+			return writtenFiles, err
+		}
+	}
+
+	if similarMatch != "" {
+		if err := writeSimilarMatchNote(fw, contractAddress, similarMatch, targetDir); err != nil {
+			return writtenFiles, &writeError{err}
+		}
+	}
+
+	if cfg.FetchCreation && !cfg.WriteMetadata {
+		metadata := contractMetadata{}
+		if err := addCreation(f, contractAddress, cfg, &metadata); err != nil {
+			return writtenFiles, err
+		}
+		fmt.Fprintf(os.Stderr, "%s: deployed by %s in transaction %s\n", contractAddress, metadata.Deployer, metadata.CreationTx)
+	}
+
+	if cfg.WriteMetadata {
+		metadata := newContractMetadata(cfg.Chain, contractAddress, result, entry)
+		if cfg.FetchCreation {
+			if err := addCreation(f, contractAddress, cfg, &metadata); err != nil {
+				return writtenFiles, err
+			}
+		}
+		if err := writeMetadata(fw, metadata, targetDir); err != nil {
+			return writtenFiles, &writeError{err}
+		}
+
+		if len(result.Libraries) > 0 {
+			if err := writeLibraries(fw, linkedLibraries(result, files), targetDir); err != nil {
+				return writtenFiles, &writeError{err}
+			}
+		}
+	}
+
+	if cfg.RemixFile != "" {
+		workspace, err := remixWorkspace(files)
+		if err != nil {
+			return writtenFiles, err
+		}
+		if err := writeOutput(cfg.RemixFile, workspace); err != nil {
+			return writtenFiles, &writeError{err}
+		}
+	}
+
+	if cfg.StandardJSON {
+		input, err := newStandardJSONInput(result, files, wOpts)
+		if err != nil {
+			return writtenFiles, err
+		}
+		if err := writeStandardJSONInput(fw, input, cfg.CompactJSON, targetDir); err != nil {
+			return writtenFiles, &writeError{err}
+		}
+	}
+
+	if cfg.ScaffoldExtras {
+		if err := writeScaffoldExtras(fw, result, targetDir); err != nil {
+			return writtenFiles, &writeError{err}
+		}
+	}
+
+	if cfg.SavePaths {
+		if err := writePathsFile(fw, savedPaths(files), targetDir); err != nil {
+			return writtenFiles, &writeError{err}
+		}
+	}
+
+	if cfg.WriteIndex {
+		if err := writeIndex(fw, files, entry, result.CompilerVersion, targetDir); err != nil {
+			return writtenFiles, &writeError{err}
+		}
+	}
+
+	if cfg.Summary {
+		printSummary(os.Stderr, contractAddress, written, files, entry, result.CompilerVersion)
+	}
+
+	return writtenFiles, nil
+}
+
+// printSummary prints the outcome of the reconstruction of a contract, to
+// tell at a glance how much of it was guessed.
+func printSummary(w io.Writer, contractAddress string, written []string, files map[FileName]*SourceCodeFile, entry *SourceCodeFile, compilerVersion string) {
+	dirs := map[string]bool{}
+	for _, p := range written {
+		dirs[path.Dir(p)] = true
+	}
+
+	packageImports := 0
+	placeholders := 0
+	for _, f := range files {
+		for _, imp := range f.Imports {
+			if isPackageImport(imp) {
+				packageImports++
+			}
+		}
+		if slices.Contains(f.PathFields, placeholderDirName) {
+			placeholders++
+		}
+	}
+
+	entryName, license := "unknown", "none"
+	if entry != nil {
+		entryName = entry.Name
+		license = valueOrNone(entry.License)
+	}
+
+	fmt.Fprintf(w, "%s: %d files in %d directories, entry %s, compiler %s, license %s, %d package imports, %d files with placeholder directories\n",
+		contractAddress, len(written), len(dirs), entryName, valueOrNone(compilerVersion), license, packageImports, placeholders)
+}
+
+// unwrittenFiles returns the names of the files that are not in the list
+// of written paths.
+func unwrittenFiles(files map[FileName]*SourceCodeFile, written []string, dstPath string, opts writeOptions) []string {
+	relPaths, _, err := writePaths(files, opts)
+	if err != nil {
+		return nil
+	}
+
+	writtenPaths := map[string]bool{}
+	for _, p := range written {
+		writtenPaths[p] = true
+	}
+
+	missing := []string{}
+	for name, relPath := range relPaths {
+		if !writtenPaths[path.Join(dstPath, relPath)] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+
+	return missing
+}
+
+// fetchMetadataOnly prints the metadata of the contract as a JSON line,
+// without reconstructing or writing the source code files. With
+// WriteMetadata, the metadata is also saved in targetDir.
+func fetchMetadataOnly(f *fetcher, contractAddress, targetDir string, cfg *config) error {
+	result, _, err := fetchSource(f, contractAddress, cfg)
+	if err != nil {
+		return err
+	}
+
+	entry, err := entryFile(result, cfg.ContractName)
+	if err != nil {
+		return err
+	}
+
+	metadata := newContractMetadata(cfg.Chain, contractAddress, result, entry)
+	if cfg.FetchCreation {
+		if err := addCreation(f, contractAddress, cfg, &metadata); err != nil {
+			return err
+		}
+	}
+
+	line, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("could not encode metadata: %v", err)
+	}
+	fmt.Println(string(line))
+
+	if cfg.WriteMetadata {
+		return writeMetadata(cfg.fileWriter(), metadata, targetDir)
+	}
+
+	return nil
+}
+
+// rawPageFileName is the file where -raw saves the explorer page.
+const rawPageFileName string = "page.html"
+
+// fetchRaw saves the explorer page of the contract in targetDir exactly as
+// it was received, without parsing it.
+func fetchRaw(f *fetcher, contractAddress, targetDir string, cfg *config) error {
+	body, _, err := f.getPage(cfg.contractURL(contractAddress))
+	if err != nil {
+		return err
+	}
+
+	fw := cfg.fileWriter()
+	if err := fw.MkdirAll(targetDir, 0750); err != nil {
+		return &writeError{fmt.Errorf("could not create directory '%s': %v", targetDir, err)}
+	}
+
+	pagePath := path.Join(targetDir, rawPageFileName)
+	if err := fw.WriteFile(pagePath, body, 0640); err != nil {
+		return &writeError{fmt.Errorf("could not save file %s: %v", pagePath, err)}
+	}
+	infof("%s: saved the explorer page in %s", contractAddress, pagePath)
+
+	return nil
+}
+
+// addCreation sets the deployer and the creation transaction of the
+// contract in the metadata.
+func addCreation(f *fetcher, contractAddress string, cfg *config, metadata *contractMetadata) error {
+	creation, err := getContractCreation(f, cfg.Chain, cfg.APIKey, contractAddress)
+	if err != nil {
+		return err
+	}
+
+	metadata.Deployer = creation.ContractCreator
+	metadata.CreationTx = creation.TxHash
+
+	return nil
+}
+
+// printFunctions prints the function and event signatures of the ABI of
+// the contract, one per line.
+func printFunctions(w io.Writer, f *fetcher, contractAddress string, cfg *config) error {
+	rawABI, err := getContractABI(f, cfg.Chain, cfg.APIKey, contractAddress)
+	if err != nil {
+		return err
+	}
+
+	signatures, err := abiSignatures(rawABI)
+	if err != nil {
+		return err
+	}
+
+	for _, signature := range signatures {
+		fmt.Fprintln(w, signature)
+	}
+
+	return nil
+}
+
+// printWritten prints the absolute path of each written file on its own
+// line.
+func printWritten(w io.Writer, written []string) error {
+	for _, p := range written {
+		absPath, err := filepath.Abs(p)
+		if err != nil {
+			return fmt.Errorf("could not get the absolute path of %s: %v", p, err)
+		}
+		fmt.Fprintln(w, absPath)
+	}
+
+	return nil
+}
+
+// confirmOverwrite asks the user whether the existing files can be
+// overwritten. When stdin is not a terminal, it fails instead of asking.
+func confirmOverwrite(existing []string) error {
+	if len(existing) == 0 {
+		return nil
+	}
+
+	if !isTerminal(os.Stdin) {
+		return fmt.Errorf("%d files would be overwritten, use -force to overwrite them", len(existing))
+	}
+
+	fmt.Fprintf(os.Stderr, "Overwrite %d existing files? [y/N] ", len(existing))
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("could not read answer: %v", err)
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		return errors.New("not overwriting existing files")
+	}
+
+	return nil
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// printImports prints every import of every file as "file: import" lines.
+func printImports(w io.Writer, files map[FileName]*SourceCodeFile) {
+	names := make([]FileName, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, imp := range files[name].Imports {
+			fmt.Fprintf(w, "%s: %s\n", name, imp)
+		}
+	}
+}
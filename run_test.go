@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestProvenance(t *testing.T) {
+	eth := chain{Name: "ethereum", ID: 1}
+	address := "0x1111111111111111111111111111111111111111"
+	similar := "0x2222222222222222222222222222222222222222"
+
+	tests := []struct {
+		name         string
+		result       *FetchResult
+		similarMatch string
+		cfg          *config
+		want         string
+	}{
+		{
+			name: "explorer",
+			cfg:  &config{Chain: eth},
+			want: "etherscan ethereum " + address,
+		},
+		{
+			name:         "similar match",
+			similarMatch: similar,
+			cfg:          &config{Chain: eth},
+			want:         "etherscan ethereum " + similar + " (similar match for " + address + ")",
+		},
+		{
+			name: "repository",
+			cfg:  &config{Chain: eth, Repo: &repoSource{Repo: "owner/repo", Commit: "0123abc", Prefix: "src"}},
+			want: "repo https://github.com/owner/repo@0123abc",
+		},
+		{
+			name:   "ipfs",
+			result: &FetchResult{MetadataCID: "QmWnZuVsHGgqdoW5EJ7cKRcDU5znScRY9vw9R4MEz4Xq8b"},
+			cfg:    &config{Chain: eth, IPFS: true},
+			want:   "ipfs QmWnZuVsHGgqdoW5EJ7cKRcDU5znScRY9vw9R4MEz4Xq8b",
+		},
+	}
+
+	for _, tt := range tests {
+		if tt.result == nil {
+			tt.result = &FetchResult{}
+		}
+		if got := provenance(tt.result, address, tt.similarMatch, tt.cfg); got != tt.want {
+			t.Errorf("%s: provenance() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+//go:build s3
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3FileWriter uploads the files as objects of an S3 bucket, under a key
+// prefix. Directories do not exist in S3, so MkdirAll does nothing. The
+// credentials and the region are taken from the standard AWS environment
+// variables.
+type s3FileWriter struct {
+	client *http.Client
+	bucket string
+	prefix string
+	region string
+
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+func newS3FileWriter(bucket, prefix string, timeout time.Duration) (*s3FileWriter, error) {
+	w := &s3FileWriter{
+		client:          &http.Client{Timeout: timeout},
+		bucket:          bucket,
+		prefix:          prefix,
+		region:          os.Getenv("AWS_REGION"),
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+
+	if w.region == "" {
+		w.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if w.region == "" {
+		return nil, errors.New("the S3 sink needs the region of the bucket in AWS_REGION")
+	}
+	if w.accessKeyID == "" || w.secretAccessKey == "" {
+		return nil, errors.New("the S3 sink needs the credentials in AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+
+	return w, nil
+}
+
+func (w *s3FileWriter) MkdirAll(path string, perm fs.FileMode) error {
+	return nil
+}
+
+func (w *s3FileWriter) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	name = path.Clean(strings.TrimPrefix(name, "/"))
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return fmt.Errorf("path %s is outside of the sink", name)
+	}
+	key := path.Join(w.prefix, name)
+
+	host := fmt.Sprintf("%s.s3.%s.amazonaws.com", w.bucket, w.region)
+	uri := "/" + s3EscapeKey(key)
+	req, err := http.NewRequest(http.MethodPut, "https://"+host+uri, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	w.sign(req, host, uri, data, time.Now().UTC())
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("could not upload s3://%s/%s: %s: %s", w.bucket, key, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// sign adds the AWS signature version 4 headers to the request. The host
+// and every header already set on the request are signed.
+func (w *s3FileWriter) sign(req *http.Request, host, uri string, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	req.Header.Set("x-amz-date", amzDate)
+	if w.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", w.sessionToken)
+	}
+
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uri,
+		"",
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + w.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+w.secretAccessKey), date)
+	key = hmacSHA256(key, w.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		w.accessKeyID, scope, signedHeaders, signature))
+}
+
+// s3EscapeKey percent-encodes every byte of the key except the unreserved
+// characters and the slashes, as required by the signature.
+func s3EscapeKey(key string) string {
+	sb := strings.Builder{}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			sb.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", c)
+	}
+	return sb.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,12 @@
+//go:build !s3
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+func newS3FileWriter(bucket, prefix string, timeout time.Duration) (FileWriter, error) {
+	return nil, errors.New("the S3 sink is not available, concode was built without the s3 build tag")
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// scaffoldExtras are the files written with -scaffold-extras, to start a
+// repository from the reconstructed contract.
+var scaffoldExtras = map[string]string{
+	".gitignore": `out/
+cache/
+node_modules/
+lib/
+`,
+	".editorconfig": `root = true
+
+[*]
+end_of_line = lf
+insert_final_newline = true
+charset = utf-8
+
+[*.sol]
+indent_style = space
+indent_size = 4
+`,
+}
+
+// writeScaffoldExtras writes the scaffold extras into dstPath, together
+// with a foundry.toml with the compiler settings of the contract.
+func writeScaffoldExtras(fw FileWriter, result *FetchResult, dstPath string) error {
+	if err := fw.MkdirAll(dstPath, 0750); err != nil {
+		return fmt.Errorf("could not create directory '%s': %v", dstPath, err)
+	}
+
+	extras := map[string]string{foundryConfigFileName: foundryConfig(result)}
+	for name, content := range scaffoldExtras {
+		extras[name] = content
+	}
+
+	for name, content := range extras {
+		filePath := path.Join(dstPath, name)
+		if err := fw.WriteFile(filePath, []byte(content), 0640); err != nil {
+			return fmt.Errorf("could not save file %s: %v", filePath, err)
+		}
+	}
+
+	return nil
+}
+
+const foundryConfigFileName string = "foundry.toml"
+
+// foundryConfig returns a foundry.toml that compiles the files with the
+// settings the contract was verified with. The IR pipeline changes the
+// bytecode, so via_ir is set when the contract used it.
+func foundryConfig(result *FetchResult) string {
+	lines := []string{"[profile.default]"}
+
+	// v0.8.19+commit.7dd6d404 is 0.8.19 for forge
+	version, _, _ := strings.Cut(strings.TrimPrefix(result.CompilerVersion, "v"), "+")
+	if version != "" {
+		lines = append(lines, fmt.Sprintf("solc_version = %q", version))
+	}
+	if result.EVMVersion != "" && result.EVMVersion != "default" {
+		lines = append(lines, fmt.Sprintf("evm_version = %q", result.EVMVersion))
+	}
+	lines = append(lines, fmt.Sprintf("optimizer = %t", result.OptimizationUsed))
+	if result.OptimizationUsed {
+		lines = append(lines, fmt.Sprintf("optimizer_runs = %d", result.Runs))
+	}
+	lines = append(lines, fmt.Sprintf("via_ir = %t", result.ViaIR))
+
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestFoundryConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *FetchResult
+		want   string
+	}{
+		{
+			name: "via ir",
+			result: &FetchResult{
+				CompilerVersion:  "v0.8.19+commit.7dd6d404",
+				EVMVersion:       "paris",
+				OptimizationUsed: true,
+				Runs:             200,
+				ViaIR:            true,
+			},
+			want: "[profile.default]\nsolc_version = \"0.8.19\"\nevm_version = \"paris\"\noptimizer = true\noptimizer_runs = 200\nvia_ir = true\n",
+		},
+		{
+			name:   "defaults",
+			result: &FetchResult{CompilerVersion: "v0.6.12+commit.27d51765", EVMVersion: "default"},
+			want:   "[profile.default]\nsolc_version = \"0.6.12\"\noptimizer = false\nvia_ir = false\n",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := foundryConfig(tt.result); got != tt.want {
+			t.Errorf("%s: foundryConfig() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
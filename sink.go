@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// newSink returns the FileWriter that saves the output into the storage
+// referenced by sinkURL. Only s3://BUCKET[/PREFIX] is supported.
+func newSink(sinkURL string, timeout time.Duration) (FileWriter, error) {
+	location, found := strings.CutPrefix(sinkURL, "s3://")
+	if !found {
+		return nil, fmt.Errorf("unsupported sink '%s', expected s3://BUCKET[/PREFIX]", sinkURL)
+	}
+
+	bucket, prefix, _ := strings.Cut(location, "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("invalid sink '%s', the bucket is missing", sinkURL)
+	}
+
+	return newS3FileWriter(bucket, strings.Trim(prefix, "/"), timeout)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+)
+
+const standardJSONFileName string = "input.json"
+
+// standardJSONInput is the solc standard JSON input of a contract.
+type standardJSONInput struct {
+	Language string                        `json:"language"`
+	Sources  map[string]standardJSONSource `json:"sources"`
+	Settings any                           `json:"settings"`
+}
+
+type standardJSONSource struct {
+	Content string `json:"content"`
+}
+
+type standardJSONSettings struct {
+	Optimizer       standardJSONOptimizer          `json:"optimizer"`
+	EVMVersion      string                         `json:"evmVersion,omitempty"`
+	ViaIR           bool                           `json:"viaIR,omitempty"`
+	OutputSelection map[string]map[string][]string `json:"outputSelection"`
+}
+
+type standardJSONOptimizer struct {
+	Enabled bool `json:"enabled"`
+	Runs    int  `json:"runs,omitempty"`
+}
+
+// newStandardJSONInput returns the standard JSON input that compiles the
+// files with the settings of the contract. Each source is named after the
+// path the file is written to with opts, which is what the imports refer
+// to, including the module root and the root name. The settings shown by
+// the explorer are kept as they are, so that per file options and the
+// output selection are preserved, otherwise they are built from the
+// compiler settings of the contract.
+func newStandardJSONInput(result *FetchResult, files map[FileName]*SourceCodeFile, opts writeOptions) (standardJSONInput, error) {
+	relPaths, _, err := writePaths(files, opts)
+	if err != nil {
+		return standardJSONInput{}, err
+	}
+
+	sources := map[string]standardJSONSource{}
+	for name, f := range files {
+		sources[relPaths[name]] = standardJSONSource{Content: f.RawContent}
+	}
+
+	if len(result.Settings) > 0 {
+		settings, err := settingsWithViaIR(result.Settings, result.ViaIR)
+		if err != nil {
+			return standardJSONInput{}, err
+		}
+		return standardJSONInput{
+			Language: "Solidity",
+			Sources:  sources,
+			Settings: settings,
+		}, nil
+	}
+
+	evmVersion := result.EVMVersion
+	if evmVersion == "default" {
+		evmVersion = ""
+	}
+
+	return standardJSONInput{
+		Language: "Solidity",
+		Sources:  sources,
+		Settings: standardJSONSettings{
+			Optimizer: standardJSONOptimizer{
+				Enabled: result.OptimizationUsed,
+				Runs:    result.Runs,
+			},
+			EVMVersion: evmVersion,
+			ViaIR:      result.ViaIR,
+			OutputSelection: map[string]map[string][]string{
+				"*": {
+					"*": {"abi", "evm.bytecode", "evm.deployedBytecode", "metadata"},
+					"":  {"ast"},
+				},
+			},
+		},
+	}, nil
+}
+
+// settingsWithViaIR returns the settings shown by the explorer, with
+// viaIR set when the contract was compiled through the IR pipeline but the
+// settings do not say so.
+func settingsWithViaIR(settings json.RawMessage, viaIR bool) (json.RawMessage, error) {
+	if !viaIR {
+		return settings, nil
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(settings, &fields); err != nil {
+		return nil, fmt.Errorf("could not decode the settings of the contract: %v", err)
+	}
+	fields["viaIR"] = json.RawMessage("true")
+
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode the settings of the contract: %v", err)
+	}
+	return raw, nil
+}
+
+// writeStandardJSONInput saves the standard JSON input into dstPath,
+// indented unless compact is set.
+func writeStandardJSONInput(fw FileWriter, input standardJSONInput, compact bool, dstPath string) error {
+	var raw []byte
+	var err error
+	if compact {
+		raw, err = json.Marshal(input)
+	} else {
+		raw, err = json.MarshalIndent(input, "", "  ")
+	}
+	if err != nil {
+		return fmt.Errorf("could not encode standard JSON input: %v", err)
+	}
+
+	if err := fw.MkdirAll(dstPath, 0750); err != nil {
+		return fmt.Errorf("could not create directory '%s': %v", dstPath, err)
+	}
+
+	inputPath := path.Join(dstPath, standardJSONFileName)
+	if err := fw.WriteFile(inputPath, append(raw, '\n'), 0640); err != nil {
+		return fmt.Errorf("could not save file %s: %v", inputPath, err)
+	}
+
+	return nil
+}
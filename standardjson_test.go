@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+	"testing"
+)
+
+// sourceUnitName returns the name of the source that solc loads for an
+// import in the source named from, without remappings.
+func sourceUnitName(from, importPath string) string {
+	if strings.HasPrefix(importPath, "./") || strings.HasPrefix(importPath, "../") {
+		return path.Join(path.Dir(from), importPath)
+	}
+	return importPath
+}
+
+func TestStandardJSONInputImports(t *testing.T) {
+	tests := []struct {
+		name            string
+		absoluteImports bool
+		basePath        string
+		opts            writeOptions
+	}{
+		{
+			name: "relative imports",
+			opts: writeOptions{ModuleRoot: "pkg", RootName: "contracts"},
+		},
+		{
+			name:            "absolute imports with the base path",
+			absoluteImports: true,
+			basePath:        "pkg/contracts",
+			opts:            writeOptions{ModuleRoot: "pkg", RootName: "contracts"},
+		},
+	}
+
+	for _, tt := range tests {
+		files := newBundle(map[FileName]string{
+			"Main.sol":  "import \"./lib/Lib.sol\";\nimport \"./interfaces/IMain.sol\";\ncontract Main {}\n",
+			"Lib.sol":   "import \"../interfaces/IMain.sol\";\nlibrary Lib {}\n",
+			"IMain.sol": "interface IMain {}\n",
+		})
+		if err := fillPaths(files, defaultPathOptions()); err != nil {
+			t.Fatal(err)
+		}
+		if tt.absoluteImports {
+			makeImportsAbsolute(files)
+		}
+		if tt.basePath != "" {
+			addBasePathToImports(files, tt.basePath, nil)
+		}
+
+		input, err := newStandardJSONInput(&FetchResult{}, files, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if _, ok := input.Sources["pkg/contracts/lib/Lib.sol"]; !ok {
+			t.Errorf("%s: sources are not named after the written paths: %v", tt.name, input.Sources)
+		}
+
+		imports := 0
+		for name, source := range input.Sources {
+			file := &SourceCodeFile{Name: path.Base(name), RawContent: source.Content}
+			fillDependenciesAndImports(file)
+			for _, imp := range file.Imports {
+				imports++
+				if _, ok := input.Sources[sourceUnitName(name, imp)]; !ok {
+					t.Errorf("%s: import '%s' in %s does not resolve to a source", tt.name, imp, name)
+				}
+			}
+		}
+		if imports != 3 {
+			t.Errorf("%s: %d imports checked, want 3", tt.name, imports)
+		}
+	}
+}
+
+func TestStandardJSONInputViaIR(t *testing.T) {
+	files := newBundle(map[FileName]string{"A.sol": "contract A {}\n"})
+	if err := fillPaths(files, defaultPathOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		result *FetchResult
+	}{
+		{"built settings", &FetchResult{ViaIR: true}},
+		{"explorer settings", &FetchResult{ViaIR: true, Settings: json.RawMessage(`{"optimizer":{"enabled":true,"runs":200}}`)}},
+		{"explorer settings with viaIR", &FetchResult{ViaIR: true, Settings: json.RawMessage(`{"viaIR":true}`)}},
+	}
+
+	for _, tt := range tests {
+		input, err := newStandardJSONInput(tt.result, files, writeOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		raw, err := json.Marshal(input.Settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		settings := struct {
+			ViaIR bool `json:"viaIR"`
+		}{}
+		if err := json.Unmarshal(raw, &settings); err != nil {
+			t.Fatal(err)
+		}
+		if !settings.ViaIR {
+			t.Errorf("%s: viaIR is not set in %s", tt.name, raw)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	stageFetch string = "fetch"
+	stageParse string = "parse"
+	stagePaths string = "paths"
+	stageWrite string = "write"
+)
+
+// stages are the stages of the pipeline, in the order they run.
+var stages = []string{stageFetch, stageParse, stagePaths, stageWrite}
+
+// stageTimings accumulates the wall-clock time spent in each stage of the
+// pipeline. A nil *stageTimings ignores the measurements.
+type stageTimings struct {
+	mu        sync.Mutex
+	durations map[string]time.Duration
+}
+
+func newStageTimings() *stageTimings {
+	return &stageTimings{durations: map[string]time.Duration{}}
+}
+
+// track adds the time elapsed since start to the stage.
+func (t *stageTimings) track(stage string, start time.Time) {
+	if t == nil {
+		return
+	}
+
+	elapsed := time.Since(start)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.durations[stage] += elapsed
+}
+
+// print writes the time spent in each stage and in total.
+func (t *stageTimings) print(w io.Writer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	total := time.Duration(0)
+	fmt.Fprintln(w, "Timings:")
+	for _, stage := range stages {
+		total += t.durations[stage]
+		fmt.Fprintf(w, "  %-6s %v\n", stage, t.durations[stage].Round(time.Millisecond))
+	}
+	fmt.Fprintf(w, "  %-6s %v\n", "total", total.Round(time.Millisecond))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// treeNode is a directory or a file of the reconstructed tree.
+type treeNode struct {
+	children map[string]*treeNode
+}
+
+// buildTree returns the layout of the reconstructed files as an indented
+// tree, like the tree command. Files without a complete path are shown in
+// the unresolved directory, where they are saved in partial mode.
+func buildTree(files map[FileName]*SourceCodeFile) string {
+	root := &treeNode{children: map[string]*treeNode{}}
+	for _, f := range files {
+		relPath, err := outputPath(f)
+		if err != nil {
+			relPath = path.Join(unresolvedDirName, f.Name)
+		}
+
+		node := root
+		for _, part := range strings.Split(relPath, "/") {
+			child, ok := node.children[part]
+			if !ok {
+				child = &treeNode{children: map[string]*treeNode{}}
+				node.children[part] = child
+			}
+			node = child
+		}
+	}
+
+	sb := &strings.Builder{}
+	sb.WriteString(".\n")
+	writeTreeNode(sb, root, "")
+
+	return sb.String()
+}
+
+func writeTreeNode(sb *strings.Builder, node *treeNode, indent string) {
+	names := make([]string, 0, len(node.children))
+	for name := range node.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		branch, childIndent := "├── ", "│   "
+		if i == len(names)-1 {
+			branch, childIndent = "└── ", "    "
+		}
+
+		sb.WriteString(indent + branch + name + "\n")
+		writeTreeNode(sb, node.children[name], indent+childIndent)
+	}
+}